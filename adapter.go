@@ -2,6 +2,10 @@ package gdbadapter
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/casbin/casbin/v2/model"
@@ -9,10 +13,15 @@ import (
 	"github.com/gogf/gf/v2/database/gdb"
 	"github.com/gogf/gf/v2/frame/g"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 const (
 	defaultTableName = "casbin_rule"
+	defaultPageSize  = 1000
 	flushEvery       = 1000
 )
 
@@ -27,50 +36,115 @@ type CasbinRule struct {
 	V5    string `orm:"v5" json:"v5"`
 	V6    string `orm:"v6" json:"v6"`
 	V7    string `orm:"v7" json:"v7"`
+	// VExtra holds the values beyond V7 as a JSON array, see WithOverflowColumn.
+	VExtra string `orm:"v_extra" json:"v_extra"`
+	// RuleHash is the SHA-256 of the whole rule carrying the unique key, see WithOverflowColumn.
+	RuleHash string `orm:"rule_hash" json:"rule_hash"`
+	// Tenant is the tenant owning the rule, see WithTenant.
+	Tenant string `orm:"tenant_id" json:"tenant_id"`
 }
 
 func (CasbinRule) TableName() string {
 	return defaultTableName
 }
 
-func (c *CasbinRule) queryString() (interface{}, []interface{}) {
+func (c *CasbinRule) queryString(layout ruleLayout) (interface{}, []interface{}) {
+	columns := layout.ruleColumns()
+	values := c.values()
 	queryArgs := []interface{}{c.PType}
 
-	queryStr := "p_type = ?"
-	if c.V0 != "" {
-		queryStr += " and v0 = ?"
-		queryArgs = append(queryArgs, c.V0)
+	queryStr := columns[0] + " = ?"
+	for i := 1; i < len(columns); i++ {
+		if values[i] != "" {
+			queryStr += " and " + columns[i] + " = ?"
+			queryArgs = append(queryArgs, values[i])
+		}
 	}
-	if c.V1 != "" {
-		queryStr += " and v1 = ?"
-		queryArgs = append(queryArgs, c.V1)
+
+	return queryStr, queryArgs
+}
+
+// values returns PType followed by the values V0 to V7.
+func (c *CasbinRule) values() []string {
+	return []string{c.PType, c.V0, c.V1, c.V2, c.V3, c.V4, c.V5, c.V6, c.V7}
+}
+
+// extraValues returns the values beyond the value columns.
+func (c *CasbinRule) extraValues() ([]string, error) {
+	if c.VExtra == "" {
+		return nil, nil
 	}
-	if c.V2 != "" {
-		queryStr += " and v2 = ?"
-		queryArgs = append(queryArgs, c.V2)
+	var extra []string
+	if err := json.Unmarshal([]byte(c.VExtra), &extra); err != nil {
+		return nil, fmt.Errorf("decode v_extra of rule %d: %w", c.ID, err)
 	}
-	if c.V3 != "" {
-		queryStr += " and v3 = ?"
-		queryArgs = append(queryArgs, c.V3)
+	return extra, nil
+}
+
+// rule returns the values of the rule after its type, without the trailing empty values.
+// Only the value columns of the layout precede the values beyond them.
+func (c *CasbinRule) rule(layout ruleLayout) ([]string, error) {
+	extra, err := c.extraValues()
+	if err != nil {
+		return nil, err
 	}
-	if c.V4 != "" {
-		queryStr += " and v4 = ?"
-		queryArgs = append(queryArgs, c.V4)
+	rule := append(c.values()[1:1+len(layout.names().Values)], extra...)
+	for len(rule) > 0 && rule[len(rule)-1] == "" {
+		rule = rule[:len(rule)-1]
 	}
-	if c.V5 != "" {
-		queryStr += " and v5 = ?"
-		queryArgs = append(queryArgs, c.V5)
+	return rule, nil
+}
+
+// typedRules returns the rules of the lines, each preceded by its section, found by type in sections, and its type.
+func typedRules(layout ruleLayout, lines []CasbinRule, sections map[string]string) ([][]string, error) {
+	rules := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		rule, err := line.rule(layout)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, append([]string{sections[line.PType], line.PType}, rule...))
 	}
-	if c.V6 != "" {
-		queryStr += " and v6 = ?"
-		queryArgs = append(queryArgs, c.V6)
+	return rules, nil
+}
+
+// args returns the values of the columns of the layout, in the order of ruleLayout.columns.
+func (c *CasbinRule) args(layout ruleLayout) []interface{} {
+	var args []interface{}
+	for _, value := range c.values()[:len(layout.ruleColumns())] {
+		args = append(args, value)
 	}
-	if c.V7 != "" {
-		queryStr += " and v7 = ?"
-		queryArgs = append(queryArgs, c.V7)
+	if layout.overflow {
+		args = append(args, c.VExtra)
+	}
+	if layout.hash {
+		args = append(args, c.RuleHash)
 	}
+	if layout.tenant {
+		args = append(args, c.Tenant)
+	}
+	return args
+}
 
-	return queryStr, queryArgs
+// data maps the columns of the layout to the values of the rule, including the empty ones.
+func (c *CasbinRule) data(layout ruleLayout) gdb.Map {
+	args := c.args(layout)
+	data := make(gdb.Map, len(args))
+	for i, column := range layout.columns() {
+		data[column] = args[i]
+	}
+	return data
+}
+
+// key returns a string identifying the rule, used to compare rules in memory.
+func (c *CasbinRule) key() string {
+	return strings.Join(append(c.values(), c.VExtra), "\x00")
+}
+
+// hash returns the hex encoded SHA-256 of the key of the rule.
+func (c *CasbinRule) hash() string {
+	sum := sha256.Sum256([]byte(c.key()))
+	return hex.EncodeToString(sum[:])
 }
 
 func (c *CasbinRule) toStringPolicy() []string {
@@ -102,28 +176,44 @@ func (c *CasbinRule) toStringPolicy() []string {
 	if c.V7 != "" {
 		policy = append(policy, c.V7)
 	}
-	return policy
+	extra, _ := c.extraValues()
+	return append(policy, extra...)
 }
 
-type Filter struct {
-	PType []string
-	V0    []string
-	V1    []string
-	V2    []string
-	V3    []string
-	V4    []string
-	V5    []string
-	V6    []string
-	V7    []string
-}
+var (
+	_ persist.ContextFilteredAdapter  = (*Adapter)(nil)
+	_ persist.ContextBatchAdapter     = (*Adapter)(nil)
+	_ persist.ContextUpdatableAdapter = (*Adapter)(nil)
+)
 
 // Adapter represents the Gorm adapter for policy store.
 type Adapter struct {
-	dbGroupName string
-	tableName   string
-	db          gdb.DB
-	ctx         context.Context
-	isFiltered  bool
+	dbGroupName     string
+	tableName       string
+	prefix          *string
+	autoCreateTable bool
+	db              gdb.DB
+	dialect         dialect
+	ctx             context.Context
+	isFiltered      bool
+	filters         []Filter
+	tenantFunc      TenantFunc
+	tableTenantFunc TenantFunc
+	tables          *tableCache
+	slaveReads      bool
+	readYourWrites  time.Duration
+	diffSave        bool
+	filteredSave    bool
+	ignoreExisting  bool
+	layout          ruleLayout
+	migrate         bool
+	tx              gdb.TX
+	pageSize        int
+	loadObserver    func(ctx context.Context, progress LoadProgress)
+	writeHooks      []writeHook
+	audit           *auditor
+	// lastWrite is the UnixNano time of the last write made through the adapter, shared by its WithTx views.
+	lastWrite *atomic.Int64
 }
 
 // finalizer is the destructor for Adapter.
@@ -133,10 +223,34 @@ func finalizer(a *Adapter) {
 
 // NewAdapter is the constructor for Adapter.
 func NewAdapter(ctx context.Context, groupName string) (*Adapter, error) {
+	return NewAdapterWithOptions(ctx, WithGroupName(groupName))
+}
+
+// NewAdapterWithOptions is the constructor for Adapter configured by functional options.
+func NewAdapterWithOptions(ctx context.Context, opts ...Option) (*Adapter, error) {
 	a := &Adapter{}
-	a.dbGroupName = groupName
+	a.dbGroupName = gdb.DefaultGroupName
 	a.tableName = defaultTableName
+	a.autoCreateTable = true
+	a.pageSize = defaultPageSize
+	a.tables = &tableCache{exists: make(map[string]bool)}
+	a.lastWrite = new(atomic.Int64)
 	a.ctx = ctx
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.tableName == "" {
+		return nil, errors.New("table name must not be empty")
+	}
+	if a.pageSize <= 0 {
+		return nil, errors.New("page size must be positive")
+	}
+	if m := a.layout.mapping; m.Values != nil && (m.PType == "" || len(m.Values) == 0 || len(m.Values) > 8) {
+		return nil, errors.New("the column mapping needs a type column and one to eight value columns")
+	}
+	if (a.layout.overflow || a.layout.text || a.layout.tenant) && !a.layout.hash {
+		return nil, errors.New("the overflow, text and tenant columns require the rule hash")
+	}
 	// Open the DB, create it if not existed.
 	err := a.open()
 	if err != nil {
@@ -150,9 +264,32 @@ func NewAdapter(ctx context.Context, groupName string) (*Adapter, error) {
 }
 
 func (a *Adapter) open() error {
-	a.db = g.DB(a.dbGroupName)
-	a.tableName = fmt.Sprintf("%s%s", a.db.GetPrefix(), a.tableName)
-	return a.createTable()
+	if a.db == nil {
+		a.db = g.DB(a.dbGroupName)
+	}
+	prefix := a.db.GetPrefix()
+	if a.prefix != nil {
+		prefix = *a.prefix
+	}
+	a.tableName = fmt.Sprintf("%s%s", prefix, a.tableName)
+	d, err := newDialect(a.db.GetConfig().Type)
+	if err != nil {
+		return err
+	}
+	a.dialect = d
+	if a.migrate {
+		if err = a.Migrate(a.ctx); err != nil {
+			return err
+		}
+	} else if a.autoCreateTable && a.tableTenantFunc == nil {
+		if err = a.createTable(a.ctx); err != nil {
+			return err
+		}
+	}
+	if a.audit != nil {
+		return a.openAudit()
+	}
+	return nil
 }
 
 func (a *Adapter) close() error {
@@ -160,6 +297,188 @@ func (a *Adapter) close() error {
 	return nil
 }
 
+// WithTx returns a view of the adapter whose reads and writes run inside the caller-owned transaction tx,
+// so they are committed or rolled back together with it. The adapter itself is left unchanged.
+//
+// The Ctx methods also join a transaction carried by their context,
+// e.g. the ctx passed to the function of gdb.DB.Transaction.
+func (a *Adapter) WithTx(tx gdb.TX) *Adapter {
+	b := *a
+	b.tx = tx
+	return &b
+}
+
+// txCtx injects the transaction bound by WithTx into ctx.
+func (a *Adapter) txCtx(ctx context.Context) context.Context {
+	if a.tx == nil {
+		return ctx
+	}
+	return gdb.WithTX(ctx, a.tx)
+}
+
+// model returns the model of the policy table bound to ctx and the adapter's transaction, if any,
+// restricted to the tenant of ctx.
+func (a *Adapter) model(ctx context.Context) *gdb.Model {
+	return a.scope(ctx, a.db.Model(a.policyTable(ctx)).Ctx(a.txCtx(ctx)))
+}
+
+// reader returns the model of the policy table for the reads of LoadPolicy and LoadFilteredPolicy.
+func (a *Adapter) reader(ctx context.Context) *gdb.Model {
+	return a.route(a.model(ctx))
+}
+
+// route sends the reads of db to the node chosen by readsMaster, overriding gf,
+// which sends the selects to the slave nodes. Reads joining a transaction run on it regardless.
+func (a *Adapter) route(db *gdb.Model) *gdb.Model {
+	if a.readsMaster() {
+		return db.Master()
+	}
+	return db.Slave()
+}
+
+// readsMaster reports whether the reads go to the master node,
+// which they do unless slave reads are enabled, and within the read-your-writes window regardless.
+func (a *Adapter) readsMaster() bool {
+	if a.readYourWrites > 0 && time.Since(time.Unix(0, a.lastWrite.Load())) < a.readYourWrites {
+		return true
+	}
+	return !a.slaveReads
+}
+
+// table returns the model of the policy table within tx, restricted to the tenant of ctx.
+func (a *Adapter) table(ctx context.Context, tx gdb.TX) *gdb.Model {
+	return a.scope(ctx, tx.Model(a.policyTable(ctx)))
+}
+
+// scope restricts the model to the rows of the tenant of ctx when the tenant column is enabled.
+func (a *Adapter) scope(ctx context.Context, db *gdb.Model) *gdb.Model {
+	if a.tenantFunc == nil {
+		return db
+	}
+	tenant, _ := a.tenant(ctx)
+	return db.Where(tenantColumn, tenant)
+}
+
+// tenant returns the tenant of ctx, "" if the tenant column is disabled,
+// or ErrNoTenant if the tenant column is enabled and ctx has no tenant.
+// The operations check it first with prepare, so that their queries never run for no tenant.
+func (a *Adapter) tenant(ctx context.Context) (string, error) {
+	if a.tenantFunc == nil {
+		return "", nil
+	}
+	tenant := a.tenantFunc(ctx)
+	if tenant == "" {
+		return "", ErrNoTenant
+	}
+	return tenant, nil
+}
+
+// transaction runs f in a transaction, joining the adapter's or the context's transaction if there is one.
+// Failures to begin, commit or roll back the transaction are wrapped with ErrTransaction.
+func (a *Adapter) transaction(ctx context.Context, f func(ctx context.Context, tx gdb.TX) error) error {
+	if err := a.prepare(ctx); err != nil {
+		return err
+	}
+	var fErr error
+	err := a.db.Transaction(a.txCtx(ctx), func(ctx context.Context, tx gdb.TX) error {
+		fErr = f(ctx, tx)
+		return fErr
+	})
+	switch {
+	case err == nil:
+		return nil
+	case fErr == nil:
+		return fmt.Errorf("%w: %w", ErrTransaction, err)
+	case err != fErr:
+		// The rollback failed after f did.
+		return fmt.Errorf("%w: %w", ErrTransaction, errors.Join(fErr, err))
+	default:
+		return err
+	}
+}
+
+// Operation identifies the kind of a policy mutation.
+type Operation string
+
+const (
+	OpAddPolicies            Operation = "add_policies"
+	OpRemovePolicies         Operation = "remove_policies"
+	OpRemoveFilteredPolicy   Operation = "remove_filtered_policy"
+	OpUpdatePolicies         Operation = "update_policies"
+	OpUpdateFilteredPolicies Operation = "update_filtered_policies"
+	OpSavePolicy             Operation = "save_policy"
+)
+
+// policyChange describes a policy mutation passed to the write hooks.
+type policyChange struct {
+	op    Operation
+	sec   string
+	ptype string
+	// rules holds the added or removed rules, or the new rules of an update.
+	// The rules added by a save are preceded by their section and type.
+	rules [][]string
+	// oldRules holds the rules replaced by an update, or the rules removed by a save preceded by their section and type.
+	oldRules    [][]string
+	fieldIndex  int
+	fieldValues []string
+	// tenant is the tenant of the mutation, see changeTenant.
+	tenant string
+}
+
+// setSaved sets the rules added and removed by a save of the model.
+// The section of a removed rule whose type is no longer in the model is empty.
+func (c *policyChange) setSaved(layout ruleLayout, model model.Model, added, removed []CasbinRule) (err error) {
+	sections := make(map[string]string)
+	for _, sec := range []string{"p", "g"} {
+		for ptype := range model[sec] {
+			sections[ptype] = sec
+		}
+	}
+	if c.rules, err = typedRules(layout, added, sections); err != nil {
+		return err
+	}
+	c.oldRules, err = typedRules(layout, removed, sections)
+	return err
+}
+
+// writeHook is called inside the transaction of every policy mutation made through the adapter.
+type writeHook func(ctx context.Context, tx gdb.TX, change *policyChange) error
+
+// addWriteHook registers a hook run by every subsequent policy mutation.
+func (a *Adapter) addWriteHook(hook writeHook) {
+	a.writeHooks = append(a.writeHooks, hook)
+}
+
+// write runs the policy mutation f and then the write hooks in a single transaction.
+// f may complete the change with values only known inside the transaction.
+// The returned error is prefixed with the operation and wrapped with ErrDuplicatePolicy on unique key violations.
+func (a *Adapter) write(ctx context.Context, change *policyChange, f func(ctx context.Context, tx gdb.TX) error) error {
+	// A missing tenant fails the transaction.
+	change.tenant, _ = a.changeTenant(ctx)
+	err := a.transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		if err := f(ctx, tx); err != nil {
+			return err
+		}
+		for _, hook := range a.writeHooks {
+			if err := hook(ctx, tx, change); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		a.lastWrite.Store(time.Now().UnixNano())
+		return nil
+	}
+	if a.dialect.isDuplicateError(err) && !errors.Is(err, ErrDuplicatePolicy) {
+		err = fmt.Errorf("%w: %w", ErrDuplicatePolicy, err)
+	}
+	if change.ptype != "" {
+		return fmt.Errorf("%s %s: %w", change.op, change.ptype, err)
+	}
+	return fmt.Errorf("%s: %w", change.op, err)
+}
+
 // getTableInstance return the dynamic table name
 func (a *Adapter) getTableInstance() *CasbinRule {
 	return &CasbinRule{}
@@ -167,7 +486,12 @@ func (a *Adapter) getTableInstance() *CasbinRule {
 
 // HasTable determine whether the table name exists in the database.
 func (a *Adapter) HasTable(name string) (bool, error) {
-	tableList, err := a.db.Tables(a.ctx)
+	return a.hasTable(a.ctx, name)
+}
+
+// hasTable reports whether the table exists with context.
+func (a *Adapter) hasTable(ctx context.Context, name string) (bool, error) {
+	tableList, err := a.db.Tables(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -179,107 +503,271 @@ func (a *Adapter) HasTable(name string) (bool, error) {
 	return false, nil
 }
 
-func (a *Adapter) createTable() error {
-	if exists, _ := a.HasTable(a.tableName); exists {
+func (a *Adapter) createTable(ctx context.Context) error {
+	return a.createTableDef(ctx, ruleTable(a.tableName, a.layout))
+}
+
+// createTableDef creates the table described by table unless it already exists.
+func (a *Adapter) createTableDef(ctx context.Context, table tableDef) error {
+	if exists, _ := a.hasTable(ctx, table.name); exists {
 		return nil
 	}
-	_, err := a.db.Exec(a.ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`id` bigint unsigned NOT NULL AUTO_INCREMENT,`p_type` VARCHAR(100),`v0` VARCHAR(100),`v1` VARCHAR(100),`v2` VARCHAR(100),`v3` VARCHAR(100),`v4` VARCHAR(100),`v5` VARCHAR(100), `v6` VARCHAR(25), `v7` VARCHAR(25),PRIMARY KEY (`id`),UNIQUE KEY `idx_%s` (`p_type`,`v0`,`v1`,`v2`,`v3`,`v4`,`v5`,`v6`,`v7`))", a.tableName, a.tableName))
-	return err
+	for _, sql := range a.dialect.createTableSQL(table) {
+		if _, err := a.db.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (a *Adapter) dropTable() error {
-	_, err := a.db.Exec(a.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", a.tableName))
+	_, err := a.db.Exec(a.ctx, a.dialect.dropTableSQL(a.tableName))
 	return err
 }
 
 func (a *Adapter) truncateTable() error {
-	_, err := a.db.Exec(a.ctx, fmt.Sprintf("TRUNCATE TABLE %s", a.tableName))
+	_, err := a.db.Exec(a.ctx, a.dialect.truncateTableSQL(a.tableName))
 	return err
 }
 
-func loadPolicyLine(line CasbinRule, model model.Model) {
-	var p = []string{line.PType,
-		line.V0, line.V1, line.V2,
-		line.V3, line.V4, line.V5,
-		line.V6, line.V7}
-	index := len(p) - 1
-	for p[index] == "" {
-		index--
+func loadPolicyLine(layout ruleLayout, line CasbinRule, model model.Model) error {
+	rule, err := line.rule(layout)
+	if err != nil {
+		return err
 	}
-	index += 1
-	p = p[:index]
+	return persist.LoadPolicyArray(append([]string{line.PType}, rule...), model)
+}
 
-	persist.LoadPolicyArray(p, model)
+// LoadProgress describes a page of rules loaded into the model, see WithLoadObserver.
+type LoadProgress struct {
+	// Page is the 1-based number of the page.
+	Page int
+	// Rows is the number of rules in the page.
+	Rows int
+	// Total is the number of rules loaded so far, including the page.
+	Total int
+	// Elapsed is the time spent querying and loading the page.
+	Elapsed time.Duration
+}
+
+// loadLines loads the rows selected by db into the model in pages ordered by id,
+// using the last id of each page as the lower bound of the next one,
+// so only a single page is held in memory at a time.
+// Tables without an id column are loaded in a single page.
+func (a *Adapter) loadLines(ctx context.Context, db *gdb.Model, model model.Model) error {
+	db = db.Safe()
+	var (
+		id     = a.layout.idColumn()
+		lastID uint
+		total  int
+	)
+	for page := 1; ; page++ {
+		start := time.Now()
+		query := db
+		if id != "" {
+			query = db.Where(id+" > ?", lastID).Order(id).Limit(a.pageSize)
+		}
+		result, err := query.All()
+		if err != nil {
+			return err
+		}
+		lines := a.layout.scanLines(result)
+		for _, line := range lines {
+			if err := loadPolicyLine(a.layout, line, model); err != nil {
+				return err
+			}
+		}
+		total += len(lines)
+		if a.loadObserver != nil {
+			a.loadObserver(ctx, LoadProgress{Page: page, Rows: len(lines), Total: total, Elapsed: time.Since(start)})
+		}
+		if id == "" || len(lines) < a.pageSize {
+			return nil
+		}
+		lastID = lines[len(lines)-1].ID
+	}
 }
 
 // LoadPolicy loads policy from database.
 func (a *Adapter) LoadPolicy(model model.Model) error {
-	var lines []CasbinRule
-	if err := a.db.Model(a.tableName).Order("id").Scan(&lines); err != nil {
+	return a.LoadPolicyCtx(a.ctx, model)
+}
+
+// LoadPolicyCtx loads policy from database with context.
+func (a *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	if err := a.prepare(ctx); err != nil {
 		return err
 	}
-	for _, line := range lines {
-		loadPolicyLine(line, model)
-	}
-
-	return nil
+	// The model now holds every rule, so the saves must no longer be restricted to the previous filters.
+	a.filters = nil
+	a.isFiltered = false
+	return a.loadLines(ctx, a.reader(ctx), model)
 }
 
 // LoadFilteredPolicy loads only policy rules that match the filter.
 func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
-	var lines []CasbinRule
+	return a.LoadFilteredPolicyCtx(a.ctx, model, filter)
+}
 
-	filterValue, ok := filter.(Filter)
-	if !ok {
-		return errors.New("invalid filter type")
-	}
-	db := a.db.Model(a.tableName).Safe().Ctx(a.ctx)
-	if len(filterValue.PType) > 0 {
-		db = db.WhereIn("p_type", filterValue.PType)
+// LoadFilteredPolicyCtx loads only policy rules that match the filter with context.
+func (a *Adapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) error {
+	filters, err := filterList(filter)
+	if err != nil {
+		return err
 	}
-	if len(filterValue.V0) > 0 {
-		db = db.WhereIn("v0", filterValue.V0)
+	if err = a.loadFiltered(ctx, model, filters); err != nil {
+		return err
 	}
-	if len(filterValue.V1) > 0 {
-		db = db.WhereIn("v1", filterValue.V1)
+	a.filters = filters
+	a.isFiltered = true
+
+	return nil
+}
+
+// LoadIncrementalFilteredPolicy loads the policy rules that match the filter into a model already holding
+// the rules of previous filters, see LoadIncrementalFilteredPolicyCtx.
+func (a *Adapter) LoadIncrementalFilteredPolicy(model model.Model, filter interface{}) error {
+	return a.LoadIncrementalFilteredPolicyCtx(a.ctx, model, filter)
+}
+
+// LoadIncrementalFilteredPolicyCtx loads the policy rules that match the filter into a model
+// already holding the rules of previous filters, skipping the rules already present,
+// and adds the filter to the ones returned by LoadedFilters, unless the whole policy is loaded.
+//
+// Enforcer.LoadIncrementalFilteredPolicy calls LoadFilteredPolicy instead, which replaces the loaded filters,
+// so call this method with the enforcer's model and rebuild its role links:
+//
+//	err := a.LoadIncrementalFilteredPolicyCtx(ctx, e.GetModel(), gdbadapter.Filter{V1: []string{"tenant2"}})
+//	err = e.BuildRoleLinks()
+func (a *Adapter) LoadIncrementalFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) error {
+	filters, err := filterList(filter)
+	if err != nil {
+		return err
 	}
-	if len(filterValue.V2) > 0 {
-		db = db.WhereIn("v2", filterValue.V2)
+	if err = a.loadFiltered(ctx, model, filters); err != nil {
+		return err
 	}
-	if len(filterValue.V3) > 0 {
-		db = db.WhereIn("v3", filterValue.V3)
+	// A model holding the whole policy stays unfiltered.
+	if a.isFiltered {
+		a.filters = append(a.filters[:len(a.filters):len(a.filters)], filters...)
 	}
-	if len(filterValue.V4) > 0 {
-		db = db.WhereIn("v4", filterValue.V4)
+
+	return nil
+}
+
+// loadFiltered loads the rules matching any of the filters into the model.
+// Rules already present in the model are skipped by persist.LoadPolicyArray.
+func (a *Adapter) loadFiltered(ctx context.Context, model model.Model, filters []Filter) error {
+	if err := a.prepare(ctx); err != nil {
+		return err
 	}
-	if len(filterValue.V5) > 0 {
-		db = db.WhereIn("v5", filterValue.V5)
+	db := a.reader(ctx).Safe()
+	where, err := a.layout.filtersWhere(db, filters)
+	if err != nil {
+		return err
 	}
-	if len(filterValue.V6) > 0 {
-		db = db.WhereIn("v6", filterValue.V6)
+	if where != nil {
+		db = db.Where(where)
 	}
-	if len(filterValue.V7) > 0 {
-		db = db.WhereIn("v7", filterValue.V7)
+	return a.loadLines(ctx, db, model)
+}
+
+// LoadedFilters returns the filters applied by the last LoadFilteredPolicy and the later incremental loads,
+// whose union selects the loaded policy, or nil if the policy is not filtered.
+func (a *Adapter) LoadedFilters() []Filter {
+	return append([]Filter(nil), a.filters...)
+}
+
+// IsFiltered returns true if the loaded policy has been filtered.
+// It returns false with filtered saving enabled, as casbin refuses to save a filtered policy.
+func (a *Adapter) IsFiltered() bool {
+	return a.isFiltered && !a.filteredSave
+}
+
+// IsFilteredCtx returns true if the loaded policy has been filtered.
+func (a *Adapter) IsFilteredCtx(ctx context.Context) bool {
+	return a.IsFiltered()
+}
+
+// checkLine returns a ValueTooLongError if a value of line does not fit in its column,
+// or ErrTooManyFields if line has more values than the layout can store.
+func (l ruleLayout) checkLine(line CasbinRule) error {
+	if line.VExtra != "" && !l.overflow {
+		return fmt.Errorf("%w: %v", ErrTooManyFields, line.toStringPolicy())
+	}
+	values := line.values()
+	for i, column := range l.ruleColumns() {
+		if size := l.columnSize(i); size > 0 && utf8.RuneCountInString(values[i]) > size {
+			return &ValueTooLongError{Column: column, Size: size, Value: values[i]}
+		}
 	}
-	if err := db.Order("id").Scan(&lines); err != nil {
-		return err
+	return nil
+}
+
+// checkFieldValues returns ErrInvalidFilter if a non-empty field value of a filtered operation has no column,
+// so the operation does not match every rule of the type.
+func (l ruleLayout) checkFieldValues(fieldIndex int, fieldValues []string) error {
+	columns := len(l.ruleColumns()) - 1
+	for i, value := range fieldValues {
+		if value != "" && (fieldIndex+i < 0 || fieldIndex+i >= columns) {
+			return fmt.Errorf("%w: no column for V%d", ErrInvalidFilter, fieldIndex+i)
+		}
 	}
+	return nil
+}
 
+// checkLines calls checkLine for every line.
+func (l ruleLayout) checkLines(lines []CasbinRule) error {
 	for _, line := range lines {
-		loadPolicyLine(line, model)
+		if err := l.checkLine(line); err != nil {
+			return err
+		}
 	}
-	a.isFiltered = true
-
 	return nil
 }
 
-// IsFiltered returns true if the loaded policy has been filtered.
-func (a *Adapter) IsFiltered() bool {
-	return a.isFiltered
+// scanLines converts rows of the policy table to rules.
+func (l ruleLayout) scanLines(result gdb.Result) []CasbinRule {
+	names := l.names()
+	lines := make([]CasbinRule, 0, len(result))
+	for _, record := range result {
+		values := make([]string, 9)
+		values[0] = record[names.PType].String()
+		for i, column := range names.Values {
+			values[i+1] = record[column].String()
+		}
+		line := CasbinRule{
+			PType: values[0],
+			V0:    values[1], V1: values[2], V2: values[3], V3: values[4],
+			V4: values[5], V5: values[6], V6: values[7], V7: values[8],
+			VExtra:   record["v_extra"].String(),
+			RuleHash: record["rule_hash"].String(),
+			Tenant:   record[tenantColumn].String(),
+		}
+		if names.ID != "" {
+			line.ID = record[names.ID].Uint()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// dataList maps the columns of the layout to the values of every line, for batch inserts.
+func (l ruleLayout) dataList(lines []CasbinRule) gdb.List {
+	list := make(gdb.List, 0, len(lines))
+	for i := range lines {
+		list = append(list, lines[i].data(l))
+	}
+	return list
 }
 
-func (a *Adapter) savePolicyLine(ptype string, rule []string) CasbinRule {
+func (a *Adapter) savePolicyLine(ctx context.Context, ptype string, rule []string) CasbinRule {
 	line := a.getTableInstance()
+	// The values beyond the value columns go to the overflow column.
+	var extra []string
+	if n := len(a.layout.names().Values); len(rule) > n {
+		rule, extra = rule[:n], rule[n:]
+	}
 
 	line.PType = ptype
 	if len(rule) > 0 {
@@ -306,94 +794,369 @@ func (a *Adapter) savePolicyLine(ptype string, rule []string) CasbinRule {
 	if len(rule) > 7 {
 		line.V7 = rule[7]
 	}
+	for len(extra) > 0 && extra[len(extra)-1] == "" {
+		extra = extra[:len(extra)-1]
+	}
+	if len(extra) > 0 {
+		value, _ := json.Marshal(extra)
+		line.VExtra = string(value)
+	}
+	if a.layout.hash {
+		line.RuleHash = line.hash()
+	}
+	line.Tenant, _ = a.tenant(ctx)
 
 	return *line
 }
 
+// SaveResult reports the rows written by SavePolicyDiff.
+type SaveResult struct {
+	Added   int
+	Removed int
+}
+
 // SavePolicy saves policy to database.
+// When diff saving is enabled it delegates to SavePolicyDiff, otherwise the stored rules are replaced within a single transaction,
+// so a failure leaves the previous policy in place. With filtered saving, a filtered policy only replaces the rows matching its filters.
 func (a *Adapter) SavePolicy(model model.Model) error {
-	err := a.truncateTable()
-	if err != nil {
+	return a.SavePolicyCtx(a.ctx, model)
+}
+
+// SavePolicyCtx saves policy to database with context.
+func (a *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	if a.filteredSave && a.isFiltered {
+		return a.saveFilteredPolicy(ctx, model)
+	}
+	if a.diffSave {
+		_, err := a.SavePolicyDiffCtx(ctx, model)
 		return err
 	}
-	var lines []CasbinRule
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			lines = append(lines, a.savePolicyLine(ptype, rule))
-			if len(lines) > flushEvery {
-				_, err = a.db.Model(a.tableName).Data(&lines).Insert()
-				if err != nil {
+	change := &policyChange{op: OpSavePolicy}
+	return a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		if len(a.writeHooks) > 0 {
+			rows, err := a.table(ctx, tx).All()
+			if err != nil {
+				return err
+			}
+			added, removed, err := a.diffLines(ctx, a.layout.scanLines(rows), model)
+			if err != nil {
+				return err
+			}
+			if err = change.setSaved(a.layout, model, added, removed); err != nil {
+				return err
+			}
+		}
+		// TRUNCATE commits implicitly on MySQL, so the rows are deleted instead.
+		if _, err := a.table(ctx, tx).Where("1=1").Delete(); err != nil {
+			return err
+		}
+		var lines []CasbinRule
+		for ptype, ast := range model["p"] {
+			for _, rule := range ast.Policy {
+				line := a.savePolicyLine(ctx, ptype, rule)
+				if err := a.layout.checkLine(line); err != nil {
 					return err
 				}
-				lines = nil
+				lines = append(lines, line)
+				if len(lines) > flushEvery {
+					if _, err := a.table(ctx, tx).Data(a.layout.dataList(lines)).Insert(); err != nil {
+						return err
+					}
+					lines = nil
+				}
 			}
 		}
-	}
 
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			lines = append(lines, a.savePolicyLine(ptype, rule))
-			if len(lines) > flushEvery {
-				_, err = a.db.Model(a.tableName).Data(&lines).Insert()
-				if err != nil {
+		for ptype, ast := range model["g"] {
+			for _, rule := range ast.Policy {
+				line := a.savePolicyLine(ctx, ptype, rule)
+				if err := a.layout.checkLine(line); err != nil {
 					return err
 				}
-				lines = nil
+				lines = append(lines, line)
+				if len(lines) > flushEvery {
+					if _, err := a.table(ctx, tx).Data(a.layout.dataList(lines)).Insert(); err != nil {
+						return err
+					}
+					lines = nil
+				}
 			}
 		}
+
+		if len(lines) > 0 {
+			if _, err := a.table(ctx, tx).Data(a.layout.dataList(lines)).Insert(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SavePolicyDiff saves policy to database by comparing the model with the stored rows,
+// deleting the rules missing from the model and inserting the new ones in a single transaction.
+// Unchanged rows keep their IDs.
+func (a *Adapter) SavePolicyDiff(model model.Model) (SaveResult, error) {
+	return a.SavePolicyDiffCtx(a.ctx, model)
+}
+
+// SavePolicyDiffCtx saves policy to database by comparing the model with the stored rows with context.
+func (a *Adapter) SavePolicyDiffCtx(ctx context.Context, model model.Model) (SaveResult, error) {
+	var result SaveResult
+	change := &policyChange{op: OpSavePolicy}
+	err := a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		rows, err := a.table(ctx, tx).All()
+		if err != nil {
+			return err
+		}
+		added, removed, err := a.diffLines(ctx, a.layout.scanLines(rows), model)
+		if err != nil {
+			return err
+		}
+		if err = change.setSaved(a.layout, model, added, removed); err != nil {
+			return err
+		}
+		if err := a.deleteLines(ctx, tx, removed); err != nil {
+			return err
+		}
+		for start := 0; start < len(added); start += flushEvery {
+			end := start + flushEvery
+			if end > len(added) {
+				end = len(added)
+			}
+			batch := added[start:end]
+			if _, err := a.table(ctx, tx).Data(a.layout.dataList(batch)).Insert(); err != nil {
+				return err
+			}
+		}
+		result.Added = len(added)
+		result.Removed = len(removed)
+		return nil
+	})
+	if err != nil {
+		return SaveResult{}, err
 	}
+	return result, nil
+}
 
-	if len(lines) > 0 {
-		_, err = a.db.Model(a.tableName).Data(&lines).Insert()
+// saveFilteredPolicy replaces the stored rules matching the loaded filters with the rules of the model
+// in a single transaction, leaving the other rows untouched.
+// Rules of the model already stored outside the filters, e.g. added through the enforcer, are kept as they are.
+func (a *Adapter) saveFilteredPolicy(ctx context.Context, model model.Model) error {
+	change := &policyChange{op: OpSavePolicy}
+	return a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		db := a.table(ctx, tx).Safe()
+		where, err := a.layout.filtersWhere(db, a.filters)
 		if err != nil {
 			return err
 		}
+		if where != nil {
+			db = db.Where(where)
+		}
+		rows, err := db.All()
+		if err != nil {
+			return err
+		}
+		added, removed, err := a.diffLines(ctx, a.layout.scanLines(rows), model)
+		if err != nil {
+			return err
+		}
+		if err = change.setSaved(a.layout, model, added, removed); err != nil {
+			return err
+		}
+		if err = a.deleteLines(ctx, tx, removed); err != nil {
+			return err
+		}
+		query := a.dialect.insertIgnoreSQL(a.policyTable(ctx), a.layout.columns(), a.layout.uniqueIndex(a.tableName).columns)
+		for _, line := range added {
+			if _, err = tx.Exec(query, line.args(a.layout)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// diffLines returns the rules of the model missing from the stored lines and the stored lines missing from the model.
+func (a *Adapter) diffLines(ctx context.Context, stored []CasbinRule, model model.Model) (added, removed []CasbinRule, err error) {
+	existing := make(map[string]struct{}, len(stored))
+	for _, line := range stored {
+		existing[line.key()] = struct{}{}
 	}
 
+	wanted := make(map[string]struct{})
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range model[sec] {
+			for _, rule := range ast.Policy {
+				line := a.savePolicyLine(ctx, ptype, rule)
+				if err := a.layout.checkLine(line); err != nil {
+					return nil, nil, err
+				}
+				key := line.key()
+				if _, ok := wanted[key]; ok {
+					continue
+				}
+				wanted[key] = struct{}{}
+				if _, ok := existing[key]; !ok {
+					added = append(added, line)
+				}
+			}
+		}
+	}
+	for _, line := range stored {
+		if _, ok := wanted[line.key()]; !ok {
+			removed = append(removed, line)
+		}
+	}
+	return added, removed, nil
+}
+
+// deleteLines deletes the stored lines, in batches by id when the table has an id column.
+func (a *Adapter) deleteLines(ctx context.Context, tx gdb.TX, lines []CasbinRule) error {
+	id := a.layout.idColumn()
+	if id == "" {
+		for _, line := range lines {
+			if _, err := a.table(ctx, tx).Where(line.data(a.layout)).Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for start := 0; start < len(lines); start += flushEvery {
+		end := start + flushEvery
+		if end > len(lines) {
+			end = len(lines)
+		}
+		ids := make([]uint, 0, end-start)
+		for _, line := range lines[start:end] {
+			ids = append(ids, line.ID)
+		}
+		if _, err := a.table(ctx, tx).WhereIn(id, ids).Delete(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // AddPolicy adds a policy rule to the store.
 func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
-	line := a.savePolicyLine(ptype, rule)
-	_, err := a.db.Model(a.tableName).Data(&line).Insert()
-	return err
+	return a.AddPolicyCtx(a.ctx, sec, ptype, rule)
+}
+
+// AddPolicyCtx adds a policy rule to the store with context.
+func (a *Adapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	if a.ignoreExisting {
+		_, err := a.AddPoliciesIgnoreExistingCtx(ctx, sec, ptype, [][]string{rule})
+		return err
+	}
+	line := a.savePolicyLine(ctx, ptype, rule)
+	return a.write(ctx, &policyChange{op: OpAddPolicies, sec: sec, ptype: ptype, rules: [][]string{rule}}, func(ctx context.Context, tx gdb.TX) error {
+		if err := a.layout.checkLine(line); err != nil {
+			return err
+		}
+		_, err := a.table(ctx, tx).Data(line.data(a.layout)).Insert()
+		return err
+	})
 }
 
 // RemovePolicy removes a policy rule from the store.
 func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
-	tx, err := a.db.Begin(a.ctx)
-	if err != nil {
-		panic(err)
-	}
-	line := a.savePolicyLine(ptype, rule)
-	err = a.rawDelete(tx, line)
-	return err
+	return a.RemovePolicyCtx(a.ctx, sec, ptype, rule)
+}
+
+// RemovePolicyCtx removes a policy rule from the store with context.
+func (a *Adapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	return a.RemovePoliciesCtx(ctx, sec, ptype, [][]string{rule})
 }
 
 // AddPolicies adds multiple policy rules to the store.
 func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return a.AddPoliciesCtx(a.ctx, sec, ptype, rules)
+}
+
+// AddPoliciesCtx adds multiple policy rules to the store with context.
+func (a *Adapter) AddPoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) error {
+	if a.ignoreExisting {
+		_, err := a.AddPoliciesIgnoreExistingCtx(ctx, sec, ptype, rules)
+		return err
+	}
 	var lines []CasbinRule
 	for _, rule := range rules {
-		lines = append(lines, a.savePolicyLine(ptype, rule))
+		lines = append(lines, a.savePolicyLine(ctx, ptype, rule))
 	}
-	if len(lines) > 0 {
-		_, err := a.db.Model(a.tableName).Data(&lines).Insert()
-		if err != nil {
+	if len(lines) == 0 {
+		return nil
+	}
+	return a.write(ctx, &policyChange{op: OpAddPolicies, sec: sec, ptype: ptype, rules: rules}, func(ctx context.Context, tx gdb.TX) error {
+		if err := a.layout.checkLines(lines); err != nil {
 			return err
 		}
+		_, err := a.table(ctx, tx).Data(a.layout.dataList(lines)).Insert()
+		return err
+	})
+}
+
+// AddPoliciesIgnoreExisting adds the rules missing from the store, skipping the existing ones instead of failing,
+// and returns the rules that were actually added.
+func (a *Adapter) AddPoliciesIgnoreExisting(sec string, ptype string, rules [][]string) ([][]string, error) {
+	return a.AddPoliciesIgnoreExistingCtx(a.ctx, sec, ptype, rules)
+}
+
+// AddPoliciesIgnoreExistingCtx adds the rules missing from the store with context and returns the rules that were actually added.
+func (a *Adapter) AddPoliciesIgnoreExistingCtx(ctx context.Context, sec string, ptype string, rules [][]string) ([][]string, error) {
+	lines := make([]CasbinRule, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, a.savePolicyLine(ctx, ptype, rule))
 	}
-	return nil
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	change := &policyChange{op: OpAddPolicies, sec: sec, ptype: ptype}
+	err := a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		if err := a.layout.checkLines(lines); err != nil {
+			return err
+		}
+		// The rows are inserted one by one, as only the affected row count tells whether a row was new.
+		query := a.dialect.insertIgnoreSQL(a.policyTable(ctx), a.layout.columns(), a.layout.uniqueIndex(a.tableName).columns)
+		for i, line := range lines {
+			result, err := tx.Exec(query, line.args(a.layout)...)
+			if err != nil {
+				return err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if affected > 0 {
+				change.rules = append(change.rules, rules[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change.rules, nil
 }
 
 // RemovePolicies removes multiple policy rules from the store.
 func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
-	return a.db.Transaction(a.ctx, func(ctx context.Context, tx gdb.TX) error {
+	return a.RemovePoliciesCtx(a.ctx, sec, ptype, rules)
+}
+
+// RemovePoliciesCtx removes multiple policy rules from the store with context.
+func (a *Adapter) RemovePoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) error {
+	change := &policyChange{op: OpRemovePolicies, sec: sec, ptype: ptype}
+	return a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		// The rules already removed, e.g. by another instance, are skipped like casbin skips the ones missing from the model.
 		for _, rule := range rules {
-			line := a.savePolicyLine(ptype, rule)
-			if err := a.rawDelete(tx, line); err != nil {
+			removed, err := a.removeLine(ctx, tx, a.savePolicyLine(ctx, ptype, rule))
+			if err != nil {
 				return err
 			}
+			if removed {
+				change.rules = append(change.rules, rule)
+			}
 		}
 		return nil
 	})
@@ -401,9 +1164,13 @@ func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) err
 
 // RemoveFilteredPolicy removes policy rules that match the filter from the store.
 func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
-	tx, err := a.db.Begin(a.ctx)
-	if err != nil {
-		panic(err)
+	return a.RemoveFilteredPolicyCtx(a.ctx, sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx removes policy rules that match the filter from the store with context.
+func (a *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	if err := a.layout.checkFieldValues(fieldIndex, fieldValues); err != nil {
+		return err
 	}
 	line := a.getTableInstance()
 
@@ -432,77 +1199,167 @@ func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int,
 	if fieldIndex <= 7 && 7 < fieldIndex+len(fieldValues) {
 		line.V7 = fieldValues[7-fieldIndex]
 	}
-	err = a.rawDelete(tx, *line)
-	return err
+	change := &policyChange{op: OpRemoveFilteredPolicy, sec: sec, ptype: ptype, fieldIndex: fieldIndex, fieldValues: fieldValues}
+	return a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		if len(a.writeHooks) > 0 {
+			condition, err := a.lineCondition(*line)
+			if err != nil {
+				return err
+			}
+			rows, err := a.table(ctx, tx).Where(condition).All()
+			if err != nil {
+				return err
+			}
+			for _, removed := range a.layout.scanLines(rows) {
+				rule, err := removed.rule(a.layout)
+				if err != nil {
+					return err
+				}
+				change.rules = append(change.rules, rule)
+			}
+		}
+		_, err := a.rawDelete(ctx, tx, *line)
+		return err
+	})
 }
 
-func (a *Adapter) rawDelete(tx gdb.TX, line CasbinRule) error {
-	db := tx.Model(a.tableName).Safe()
-	condition := gdb.Map{"p_type": line.PType}
-	if line.V0 != "" {
-		condition["v0"] = line.V0
-	}
-	if line.V1 != "" {
-		condition["v1"] = line.V1
-	}
-	if line.V2 != "" {
-		condition["v2"] = line.V2
-	}
-	if line.V3 != "" {
-		condition["v3"] = line.V3
-	}
-	if line.V4 != "" {
-		condition["v4"] = line.V4
-	}
-	if line.V5 != "" {
-		condition["v5"] = line.V5
+// removeLine deletes the rule of line and reports whether it existed.
+func (a *Adapter) removeLine(ctx context.Context, tx gdb.TX, line CasbinRule) (removed bool, err error) {
+	var affected int64
+	if a.layout.hash {
+		var result sql.Result
+		if result, err = a.table(ctx, tx).Where("rule_hash", line.RuleHash).Delete(); err == nil {
+			affected, err = result.RowsAffected()
+		}
+	} else {
+		affected, err = a.rawDelete(ctx, tx, line)
 	}
-	if line.V6 != "" {
-		condition["v6"] = line.V6
+	return affected > 0, err
+}
+
+// lineCondition returns the condition selecting the rows matching the non-empty fields of line,
+// failing with ErrInvalidFilter if one of them has no column, as the condition would match more rows.
+func (a *Adapter) lineCondition(line CasbinRule) (gdb.Map, error) {
+	if line.VExtra != "" {
+		return nil, fmt.Errorf("%w: no column for %s", ErrInvalidFilter, line.VExtra)
+	}
+	columns := a.layout.ruleColumns()
+	values := line.values()
+	condition := gdb.Map{columns[0]: line.PType}
+	for i := 1; i < len(values); i++ {
+		if values[i] == "" {
+			continue
+		}
+		if i >= len(columns) {
+			return nil, fmt.Errorf("%w: no column for V%d", ErrInvalidFilter, i-1)
+		}
+		condition[columns[i]] = values[i]
 	}
-	if line.V7 != "" {
-		condition["v7"] = line.V7
+	return condition, nil
+}
+
+// rawDelete deletes the rows matching the non-empty fields of line and returns their number.
+func (a *Adapter) rawDelete(ctx context.Context, tx gdb.TX, line CasbinRule) (int64, error) {
+	condition, err := a.lineCondition(line)
+	if err != nil {
+		return 0, err
 	}
-	if _, err := db.Delete(condition); err != nil {
-		return tx.Rollback()
+	result, err := a.table(ctx, tx).Safe().Delete(condition)
+	if err != nil {
+		return 0, err
 	}
-	return tx.Commit()
+	return result.RowsAffected()
 }
 
 // UpdatePolicy updates a new policy rule to DB.
 func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newPolicy []string) error {
-	oldLine := a.savePolicyLine(ptype, oldRule)
-	newLine := a.savePolicyLine(ptype, newPolicy)
-	_, err := a.db.Model(a.tableName).Where(&oldLine).Data(newLine).OmitEmpty().Update()
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.UpdatePolicyCtx(a.ctx, sec, ptype, oldRule, newPolicy)
 }
 
+// UpdatePolicyCtx updates a new policy rule to DB with context.
+func (a *Adapter) UpdatePolicyCtx(ctx context.Context, sec string, ptype string, oldRule, newPolicy []string) error {
+	oldLine := a.savePolicyLine(ctx, ptype, oldRule)
+	newLine := a.savePolicyLine(ctx, ptype, newPolicy)
+	return a.write(ctx, &policyChange{op: OpUpdatePolicies, sec: sec, ptype: ptype, rules: [][]string{newPolicy}, oldRules: [][]string{oldRule}}, func(ctx context.Context, tx gdb.TX) error {
+		if err := a.layout.checkLine(newLine); err != nil {
+			return err
+		}
+		return a.updateLine(ctx, tx, oldLine, newLine)
+	})
+}
+
+// UpdatePolicies updates some policy rules to DB.
 func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return a.UpdatePoliciesCtx(a.ctx, sec, ptype, oldRules, newRules)
+}
+
+// UpdatePoliciesCtx updates some policy rules to DB with context.
+func (a *Adapter) UpdatePoliciesCtx(ctx context.Context, sec string, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("update %d rules with %d new rules", len(oldRules), len(newRules))
+	}
 	oldPolicies := make([]CasbinRule, 0, len(oldRules))
 	newPolicies := make([]CasbinRule, 0, len(oldRules))
 	for _, oldRule := range oldRules {
-		oldPolicies = append(oldPolicies, a.savePolicyLine(ptype, oldRule))
+		oldPolicies = append(oldPolicies, a.savePolicyLine(ctx, ptype, oldRule))
 	}
 	for _, newRule := range newRules {
-		newPolicies = append(newPolicies, a.savePolicyLine(ptype, newRule))
+		newPolicies = append(newPolicies, a.savePolicyLine(ctx, ptype, newRule))
 	}
-	tx, err := a.db.Begin(a.ctx)
+	return a.write(ctx, &policyChange{op: OpUpdatePolicies, sec: sec, ptype: ptype, rules: newRules, oldRules: oldRules}, func(ctx context.Context, tx gdb.TX) error {
+		if err := a.layout.checkLines(newPolicies); err != nil {
+			return err
+		}
+		for i := range oldPolicies {
+			if err := a.updateLine(ctx, tx, oldPolicies[i], newPolicies[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// updateLine replaces the whole row of oldLine with newLine, returning ErrPolicyNotFound if oldLine does not exist.
+func (a *Adapter) updateLine(ctx context.Context, tx gdb.TX, oldLine, newLine CasbinRule) error {
+	where := oldLine.data(a.layout)
+	data := newLine.data(a.layout)
+	// The updated_at column is added by the migrations, the tables created without them have none.
+	fields, err := a.db.TableFields(ctx, a.policyTable(ctx))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	for i := range oldPolicies {
-		if _, err = tx.Model(a.tableName).Where(&oldPolicies[i]).Data(newPolicies[i]).OmitEmpty().Update(); err != nil {
-			return tx.Rollback()
-		}
+	if _, ok := fields["updated_at"]; ok {
+		data["updated_at"] = time.Now()
+	}
+	result, err := a.table(ctx, tx).Where(where).Data(data).Update()
+	if err != nil {
+		return err
 	}
-	return tx.Commit()
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	// MySQL does not count the rows whose values are unchanged.
+	count, err := a.table(ctx, tx).Where(where).Count()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %v", ErrPolicyNotFound, oldLine.toStringPolicy())
+	}
+	return nil
 }
 
+// UpdateFilteredPolicies deletes old rules and adds new rules.
 func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newPolicies [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
-	// UpdateFilteredPolicies deletes old rules and adds new rules.
+	return a.UpdateFilteredPoliciesCtx(a.ctx, sec, ptype, newPolicies, fieldIndex, fieldValues...)
+}
+
+// UpdateFilteredPoliciesCtx deletes old rules and adds new rules with context.
+func (a *Adapter) UpdateFilteredPoliciesCtx(ctx context.Context, sec string, ptype string, newPolicies [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	if err := a.layout.checkFieldValues(fieldIndex, fieldValues); err != nil {
+		return nil, err
+	}
 	line := a.getTableInstance()
 
 	line.PType = ptype
@@ -532,49 +1389,41 @@ func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newPolicies [
 	}
 
 	newP := make([]CasbinRule, 0, len(newPolicies))
-	oldP := make([]CasbinRule, 0)
 	for _, newRule := range newPolicies {
-		newP = append(newP, a.savePolicyLine(ptype, newRule))
-	}
-	tx, err := a.db.Begin(a.ctx)
-	if err != nil {
-		panic(err)
+		newP = append(newP, a.savePolicyLine(ctx, ptype, newRule))
 	}
-
-	for i := range newP {
-		str, args := line.queryString()
-		if err = tx.Model(a.tableName).Where(str, args...).Scan(&oldP); err != nil {
-			err = tx.Rollback()
-			if err != nil {
-				return nil, err
-			}
-			return nil, err
+	change := &policyChange{op: OpUpdateFilteredPolicies, sec: sec, ptype: ptype, rules: newPolicies, fieldIndex: fieldIndex, fieldValues: fieldValues}
+	err := a.write(ctx, change, func(ctx context.Context, tx gdb.TX) error {
+		if err := a.layout.checkLines(newP); err != nil {
+			return err
 		}
-		if _, err = tx.Model(a.tableName).Where(str, args...).Delete([]CasbinRule{}); err != nil {
-			err = tx.Rollback()
+		str, args := line.queryString(a.layout)
+		rows, err := a.table(ctx, tx).Where(str, args...).All()
+		if err != nil {
+			return err
+		}
+		for _, v := range a.layout.scanLines(rows) {
+			rule, err := v.rule(a.layout)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			return nil, err
+			change.oldRules = append(change.oldRules, rule)
 		}
-		if _, err = tx.Model(a.tableName).Data(&newP[i]).Insert(); err != nil {
-			err = tx.Rollback()
-			if err != nil {
-				return nil, err
+		if _, err := a.table(ctx, tx).Where(str, args...).Delete(); err != nil {
+			return err
+		}
+		if len(newP) > 0 {
+			if _, err := a.table(ctx, tx).Data(a.layout.dataList(newP)).Insert(); err != nil {
+				return err
 			}
-			return nil, err
 		}
-	}
-
-	// return deleted rulues
-	oldPolicies := make([][]string, 0)
-	for _, v := range oldP {
-		oldPolicy := v.toStringPolicy()
-		oldPolicies = append(oldPolicies, oldPolicy)
-	}
-	err = tx.Commit()
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return oldPolicies, err
+
+	// return deleted rulues
+	oldPolicies := make([][]string, 0, len(change.oldRules))
+	return append(oldPolicies, change.oldRules...), nil
 }
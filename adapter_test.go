@@ -2,18 +2,23 @@ package gdbadapter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/util"
 	_ "github.com/gogf/gf/contrib/drivers/mysql/v2"
 	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
 	"github.com/stretchr/testify/assert"
 	"log"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func testGetPolicy(t *testing.T, e *casbin.Enforcer, res [][]string) {
-	myRes := e.GetPolicy()
+	myRes, _ := e.GetPolicy()
 	log.Print("Policy: ", myRes)
 
 	if !util.Array2DEquals(res, myRes) {
@@ -22,7 +27,7 @@ func testGetPolicy(t *testing.T, e *casbin.Enforcer, res [][]string) {
 }
 
 func testGetPolicyWithoutOrder(t *testing.T, e *casbin.Enforcer, res [][]string) {
-	myRes := e.GetPolicy()
+	myRes, _ := e.GetPolicy()
 	log.Print("Policy: ", myRes)
 
 	if !arrayEqualsWithoutOrder(myRes, res) {
@@ -96,7 +101,7 @@ func initPolicy(t *testing.T, a *Adapter) {
 func cleanPolicy(ctx context.Context, a *Adapter) {
 	// Clear the current policy.
 	if a.tableName != "" {
-		_, _ = a.db.Exec(ctx, fmt.Sprintf("TRUNCATE TABLE %s", a.tableName))
+		_ = a.truncateTable()
 	}
 }
 
@@ -327,3 +332,538 @@ func TestAddPoliciesFullColumn(t *testing.T) {
 	})
 	cleanPolicy(ctx, a)
 }
+
+func TestNewAdapterWithOptions(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx,
+		WithDB(g.DB(gdb.DefaultGroupName)),
+		WithTableName("casbin_rule_options"),
+		WithPrefix("test_"),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "test_casbin_rule_options", a.tableName)
+
+	exists, err := a.HasTable(a.tableName)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	_, err = e.AddPolicy("alice", "data1", "read")
+	assert.Nil(t, err)
+	assert.Nil(t, e.LoadPolicy())
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	assert.Nil(t, a.dropTable())
+
+	a, err = NewAdapterWithOptions(ctx, WithTableName("casbin_rule_manual"), WithAutoCreateTable(false))
+	assert.Nil(t, err)
+	exists, err = a.HasTable(a.tableName)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestSavePolicyAtomic(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+
+	// A duplicated rule violates the unique key in the middle of the save.
+	ast := e.GetModel()["p"]["p"]
+	ast.Policy = append(ast.Policy, []string{"carol", "data3", "read"}, []string{"carol", "data3", "read"})
+	assert.NotNil(t, a.SavePolicy(e.GetModel()))
+
+	// The previously stored policy is still intact.
+	assert.Nil(t, e.LoadPolicy())
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	cleanPolicy(ctx, a)
+}
+
+func TestSavePolicyDiff(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+
+	aliceID, err := a.db.Model(a.tableName).Where("v0", "alice").Value("id")
+	assert.Nil(t, err)
+
+	e.EnableAutoSave(false)
+	_, _ = e.RemovePolicy("bob", "data2", "write")
+	_, _ = e.AddPolicy("carol", "data3", "read")
+	result, err := a.SavePolicyDiff(e.GetModel())
+	assert.Nil(t, err)
+	assert.Equal(t, SaveResult{Added: 1, Removed: 1}, result)
+
+	// Nothing changed since the last save.
+	result, err = a.SavePolicyDiff(e.GetModel())
+	assert.Nil(t, err)
+	assert.Equal(t, SaveResult{}, result)
+
+	// Unchanged rows keep their IDs.
+	id, err := a.db.Model(a.tableName).Where("v0", "alice").Value("id")
+	assert.Nil(t, err)
+	assert.Equal(t, aliceID.Uint(), id.Uint())
+
+	assert.Nil(t, e.LoadPolicy())
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}})
+	cleanPolicy(ctx, a)
+}
+
+func TestContextAdapter(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+
+	assert.Nil(t, a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}))
+	assert.Nil(t, a.RemovePoliciesCtx(ctx, "p", "p", [][]string{{"bob", "data2", "write"}}))
+	assert.Nil(t, a.LoadPolicyCtx(ctx, e.GetModel()))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}})
+
+	// A cancelled context reaches the database.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	e.ClearPolicy()
+	assert.NotNil(t, a.LoadPolicyCtx(cancelled, e.GetModel()))
+	assert.NotNil(t, a.AddPolicyCtx(cancelled, "p", "p", []string{"dave", "data4", "read"}))
+	cleanPolicy(ctx, a)
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+
+	// Changes made through the view are rolled back with the outer transaction.
+	tx, err := a.db.Begin(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, a.WithTx(tx).AddPolicy("p", "p", []string{"carol", "data3", "read"}))
+	assert.Nil(t, a.WithTx(tx).RemovePolicy("p", "p", []string{"bob", "data2", "write"}))
+	assert.Nil(t, tx.Rollback())
+	assert.Nil(t, a.LoadPolicy(e.GetModel()))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// The Ctx methods join the transaction carried by the context.
+	err = a.db.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		return a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"})
+	})
+	assert.Nil(t, err)
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadPolicy(e.GetModel()))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}})
+	cleanPolicy(ctx, a)
+}
+
+func TestLoadPolicyPaginated(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+
+	var pages []LoadProgress
+	paged, err := NewAdapterWithOptions(ctx,
+		WithPageSize(2),
+		WithLoadObserver(func(ctx context.Context, progress LoadProgress) {
+			pages = append(pages, progress)
+		}),
+	)
+	assert.Nil(t, err)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", paged)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	// Five rules are loaded in pages of two.
+	assert.Len(t, pages, 3)
+	assert.Equal(t, 2, pages[0].Rows)
+	assert.Equal(t, 1, pages[2].Rows)
+	assert.Equal(t, 5, pages[2].Total)
+	cleanPolicy(ctx, a)
+}
+
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+
+	err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"})
+	assert.True(t, errors.Is(err, ErrDuplicatePolicy))
+	// Removals skip the rules already gone, as the model of the enforcer may be stale.
+	assert.Nil(t, a.RemovePolicy("p", "p", []string{"nobody", "data1", "read"}))
+	assert.Nil(t, a.RemovePolicies("p", "p", [][]string{{"nobody", "data1", "read"}, {"bob", "data2", "write"}}))
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	err = a.AddPolicy("p", "p", []string{"alice", "data1", "read", "", "", "", strings.Repeat("x", 26)})
+	assert.True(t, errors.Is(err, ErrValueTooLong))
+	err = a.LoadFilteredPolicy(nil, "not a filter")
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+	cleanPolicy(ctx, a)
+}
+
+func TestAddPoliciesIgnoreExisting(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+
+	added, err := a.AddPoliciesIgnoreExisting("p", "p", [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}, {"carol", "data3", "read"}})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"carol", "data3", "read"}}, added)
+
+	// Re-running the grant adds nothing.
+	added, err = a.AddPoliciesIgnoreExisting("p", "p", [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}})
+	assert.Nil(t, err)
+	assert.Empty(t, added)
+
+	b, err := NewAdapterWithOptions(ctx, WithIgnoreExisting(true))
+	assert.Nil(t, err)
+	assert.Nil(t, b.AddPolicies("p", "p", [][]string{{"bob", "data2", "write"}, {"dave", "data4", "read"}}))
+
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}, {"dave", "data4", "read"}})
+	cleanPolicy(ctx, a)
+}
+
+func TestUpdatePolicyFullRow(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+
+	assert.Nil(t, a.AddPolicy("p", "p", []string{"carol", "data3", "read", "tenant1"}))
+	assert.Nil(t, a.UpdatePolicy("p", "p", []string{"carol", "data3", "read", "tenant1"}, []string{"carol", "data3", "write"}))
+	record, err := a.db.Model(a.tableName).Ctx(ctx).Where("v0", "carol").One()
+	assert.Nil(t, err)
+	assert.Equal(t, "write", record["v2"].String())
+	assert.Equal(t, "", record["v3"].String())
+
+	// The old rule must match exactly, not as a prefix.
+	err = a.UpdatePolicy("p", "p", []string{"carol", "data3"}, []string{"carol", "data4", "write"})
+	assert.True(t, errors.Is(err, ErrPolicyNotFound))
+	err = a.UpdatePolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"nobody", "data1", "read"}}, [][]string{{"alice", "data1", "write"}, {"nobody", "data1", "write"}})
+	assert.True(t, errors.Is(err, ErrPolicyNotFound))
+
+	// A failed batch leaves every rule unchanged.
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	hasPolicy, err := e.HasPolicy("alice", "data1", "read")
+	assert.Nil(t, err)
+	assert.True(t, hasPolicy)
+	cleanPolicy(ctx, a)
+}
+
+func TestOverflowColumn(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_overflow"), WithOverflowColumn(true))
+	assert.Nil(t, err)
+	defer func() {
+		_ = a.dropTable()
+	}()
+
+	long := []string{"alice", "data1", "read", "a3", "a4", "a5", "a6", "a7", "a8", "a9"}
+	assert.Nil(t, a.AddPolicy("p", "p", long))
+	assert.True(t, errors.Is(a.AddPolicy("p", "p", long), ErrDuplicatePolicy))
+	// A rule differing only beyond V7 is a distinct rule.
+	assert.Nil(t, a.AddPolicy("p", "p", append(long[:9:9], "b9")))
+
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{long, append(long[:9:9], "b9")})
+
+	assert.Nil(t, a.RemovePolicy("p", "p", long))
+	assert.Nil(t, e.LoadPolicy())
+	testGetPolicy(t, e, [][]string{append(long[:9:9], "b9")})
+}
+
+func TestRuleHash(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_hash"), WithTextColumns(true))
+	assert.Nil(t, err)
+	defer func() {
+		_ = a.dropTable()
+	}()
+
+	long := []string{"alice", strings.Repeat("d", 500), "read"}
+	assert.Nil(t, a.AddPolicy("p", "p", long))
+	assert.True(t, errors.Is(a.AddPolicy("p", "p", long), ErrDuplicatePolicy))
+	added, err := a.AddPoliciesIgnoreExisting("p", "p", [][]string{long, {"bob", "data2", "write"}})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"bob", "data2", "write"}}, added)
+
+	_, err = NewAdapterWithOptions(ctx, WithTextColumns(true), WithRuleHash(false))
+	assert.NotNil(t, err)
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	// A table with the original layout.
+	legacy, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_migrate"))
+	assert.Nil(t, err)
+	defer func() {
+		_, _ = legacy.db.Exec(ctx, legacy.dialect.dropTableSQL(legacy.tableName+schemaVersionTableSuffix))
+		_ = legacy.dropTable()
+	}()
+	assert.Nil(t, legacy.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}))
+
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_migrate"), WithRuleHash(true), WithMigrate(true))
+	assert.Nil(t, err)
+	version, err := a.SchemaVersion(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, version)
+	// Migrating again is a no-op.
+	assert.Nil(t, a.Migrate(ctx))
+
+	// The stored rules got their hash, and v6 accepts longer values.
+	assert.True(t, errors.Is(a.AddPolicy("p", "p", []string{"alice", "data1", "read"}), ErrDuplicatePolicy))
+	long := []string{"carol", "data3", "read", "", "", "", strings.Repeat("x", 80)}
+	assert.Nil(t, a.AddPolicy("p", "p", long))
+	assert.Nil(t, a.RemovePolicy("p", "p", []string{"bob", "data2", "write"}))
+	record, err := a.db.Model(a.tableName).Ctx(ctx).Where("v0", "carol").One()
+	assert.Nil(t, err)
+	assert.False(t, record["created_at"].IsEmpty())
+	fields, err := a.db.TableFields(ctx, a.tableName)
+	assert.Nil(t, err)
+	assert.False(t, fields["rule_hash"].Null)
+
+	// Updates maintain updated_at.
+	_, err = a.db.Model(a.tableName).Ctx(ctx).Data(g.Map{"updated_at": "2000-01-01 00:00:00"}).Where("v0", "alice").Update()
+	assert.Nil(t, err)
+	assert.Nil(t, a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}))
+	record, err = a.db.Model(a.tableName).Ctx(ctx).Where("v0", "alice").One()
+	assert.Nil(t, err)
+	assert.True(t, record["updated_at"].Time().After(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)))
+
+	// Overflowing rules get the v_extra column.
+	overflow, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_migrate"), WithRuleHash(true), WithOverflowColumn(true), WithMigrate(true))
+	assert.Nil(t, err)
+	assert.Nil(t, overflow.AddPolicy("p", "p", []string{"dave", "data4", "read", "1", "2", "3", "4", "5", "6", "7"}))
+	record, err = a.db.Model(a.tableName).Ctx(ctx).Where("v0", "dave").One()
+	assert.Nil(t, err)
+	assert.Equal(t, `["6","7"]`, record["v_extra"].String())
+}
+
+func TestGormAdapterColumnMapping(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_gorm"), WithColumnMapping(GormAdapterColumnMapping))
+	assert.Nil(t, err)
+	defer func() {
+		_ = a.dropTable()
+	}()
+	fields, err := a.db.TableFields(ctx, a.tableName)
+	assert.Nil(t, err)
+	assert.Contains(t, fields, "ptype")
+	assert.NotContains(t, fields, "v6")
+
+	initPolicy(t, a)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	assert.Nil(t, a.RemoveFilteredPolicy("p", "p", 0, "data2_admin"))
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), Filter{PType: []string{"p"}, V0: []string{"alice", "data2_admin"}}))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	err = a.LoadFilteredPolicy(e.GetModel(), Filter{V6: []string{"x"}})
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+}
+
+func TestBatchFilter(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+
+	e.ClearPolicy()
+	err = a.LoadFilteredPolicy(e.GetModel(), &BatchFilter{Filters: []Filter{
+		{PType: []string{"p"}, V0: []string{"bob"}},
+		{PType: []string{"g"}, V0: []string{"alice"}},
+	}})
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}})
+	groupingPolicy, err := e.GetGroupingPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"alice", "data2_admin"}}, groupingPolicy)
+
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), &Filter{V0: []string{"alice"}}))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	cleanPolicy(ctx, a)
+}
+
+func TestFilterConditions(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), Filter{
+		PType:      []string{"p"},
+		Conditions: []Condition{{Field: FieldV0, Match: MatchPrefix, Values: []string{"data2_"}}},
+	}))
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), Filter{
+		PType: []string{"p"},
+		Conditions: []Condition{
+			{Field: FieldV0, Match: MatchNotIn, Values: []string{"alice", "bob"}},
+			{Field: FieldV2, Match: MatchLike, Values: []string{"w%"}},
+		},
+	}))
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "write"}})
+
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), Filter{
+		Conditions: []Condition{{Field: FieldV2, Match: MatchEmpty}},
+	}))
+	groupingPolicy, err := e.GetGroupingPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"alice", "data2_admin"}}, groupingPolicy)
+	testGetPolicy(t, e, [][]string{})
+
+	err = a.LoadFilteredPolicy(e.GetModel(), Filter{Conditions: []Condition{{Field: FieldV0, Match: MatchPrefix}}})
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+	cleanPolicy(ctx, a)
+}
+
+func TestLoadIncrementalFilteredPolicy(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), Filter{V0: []string{"alice"}}))
+	assert.Nil(t, a.LoadIncrementalFilteredPolicyCtx(ctx, e.GetModel(), Filter{PType: []string{"p"}, V1: []string{"data1", "data2"}}))
+	assert.Nil(t, e.BuildRoleLinks())
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+	assert.True(t, a.IsFiltered())
+	assert.Equal(t, []Filter{{V0: []string{"alice"}}, {PType: []string{"p"}, V1: []string{"data1", "data2"}}}, a.LoadedFilters())
+	ok, err := e.Enforce("alice", "data2", "write")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadFilteredPolicy(e.GetModel(), Filter{V0: []string{"bob"}}))
+	assert.Equal(t, []Filter{{V0: []string{"bob"}}}, a.LoadedFilters())
+
+	// After a full load, the model still holds the whole policy.
+	assert.Nil(t, a.LoadPolicy(e.GetModel()))
+	assert.Nil(t, a.LoadIncrementalFilteredPolicyCtx(ctx, e.GetModel(), Filter{V0: []string{"alice"}}))
+	assert.False(t, a.IsFiltered())
+	assert.Nil(t, a.LoadedFilters())
+	cleanPolicy(ctx, a)
+}
+
+func TestFilteredSave(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	b, err := NewAdapterWithOptions(ctx, WithFilteredSave(true))
+	assert.Nil(t, err)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", b)
+	assert.Nil(t, err)
+
+	assert.Nil(t, e.LoadFilteredPolicy(Filter{PType: []string{"p"}, V1: []string{"data2"}}))
+	assert.False(t, e.IsFiltered())
+	e.EnableAutoSave(false)
+	_, _ = e.RemovePolicy("bob", "data2", "write")
+	_, _ = e.AddPolicy("carol", "data2", "read")
+	assert.Nil(t, e.SavePolicy())
+
+	// The rows outside the filter are left untouched.
+	e, err = casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data2", "read"}})
+	groupingPolicy, err := e.GetGroupingPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"alice", "data2_admin"}}, groupingPolicy)
+
+	// A full load after a filtered one makes the saves replace every row again.
+	e, err = casbin.NewEnforcer("examples/rbac_model.conf", b)
+	assert.Nil(t, err)
+	assert.Nil(t, e.LoadFilteredPolicy(Filter{PType: []string{"p"}, V1: []string{"data2"}}))
+	assert.Nil(t, e.LoadPolicy())
+	assert.Empty(t, b.LoadedFilters())
+	e.EnableAutoSave(false)
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	_, _ = e.RemoveGroupingPolicy("alice", "data2_admin")
+	assert.Nil(t, e.SavePolicy())
+	e, err = casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data2", "read"}})
+	groupingPolicy, err = e.GetGroupingPolicy()
+	assert.Nil(t, err)
+	assert.Empty(t, groupingPolicy)
+	cleanPolicy(ctx, a)
+}
+
+type tenantKey struct{}
+
+func contextTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+func TestTenant(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_tenant"), WithTenant(contextTenant))
+	assert.Nil(t, err)
+	defer func() {
+		_ = a.dropTable()
+	}()
+	ctx1 := context.WithValue(ctx, tenantKey{}, "tenant1")
+	ctx2 := context.WithValue(ctx, tenantKey{}, "tenant2")
+
+	// The same rule may be stored by several tenants.
+	assert.Nil(t, a.AddPoliciesCtx(ctx1, "p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}))
+	assert.Nil(t, a.AddPolicyCtx(ctx2, "p", "p", []string{"alice", "data1", "read"}))
+	// The rule of another tenant is not removed.
+	assert.Nil(t, a.RemovePolicyCtx(ctx2, "p", "p", []string{"bob", "data2", "write"}))
+
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf")
+	assert.Nil(t, err)
+	assert.Nil(t, a.LoadPolicyCtx(ctx2, e.GetModel()))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+
+	// SavePolicy replaces the rules of the tenant only.
+	_, _ = e.AddPolicy("carol", "data3", "read")
+	assert.Nil(t, a.SavePolicyCtx(ctx2, e.GetModel()))
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadPolicyCtx(ctx1, e.GetModel()))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	assert.True(t, errors.Is(a.LoadPolicyCtx(ctx, e.GetModel()), ErrNoTenant))
+	assert.True(t, errors.Is(a.AddPolicyCtx(ctx, "p", "p", []string{"dave", "data4", "read"}), ErrNoTenant))
+}
+
+func TestReadWriteSplitting(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	b, err := NewAdapterWithOptions(ctx, WithSlaveReads(true), WithReadYourWrites(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), b.lastWrite.Load())
+
+	// The group has no slave node, so the reads fall back to the master node.
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", b)
+	assert.Nil(t, err)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	_, err = e.AddPolicy("carol", "data3", "read")
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), b.WithTx(nil).lastWrite.Load())
+	e.ClearPolicy()
+	assert.Nil(t, e.LoadPolicy())
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}})
+	cleanPolicy(ctx, a)
+}
+
+func TestReadsMaster(t *testing.T) {
+	a := &Adapter{lastWrite: new(atomic.Int64)}
+	assert.True(t, a.readsMaster())
+
+	a.slaveReads = true
+	assert.False(t, a.readsMaster())
+
+	// Within the read-your-writes window, the reads go to the master node.
+	a.readYourWrites = time.Minute
+	a.lastWrite.Store(time.Now().UnixNano())
+	assert.True(t, a.readsMaster())
+	// Outside of it, they go to the slave nodes again.
+	a.lastWrite.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	assert.False(t, a.readsMaster())
+}
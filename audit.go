@@ -0,0 +1,230 @@
+package gdbadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"time"
+)
+
+const auditTableSuffix = "_audit"
+
+// ActorFunc returns the actor responsible for the policy changes made with ctx, e.g. the authenticated user.
+type ActorFunc func(ctx context.Context) string
+
+// auditor records the policy mutations in the audit table.
+type auditor struct {
+	tableName string
+	actorFunc ActorFunc
+}
+
+// AuditEntry is a rule change recorded in the audit table.
+type AuditEntry struct {
+	ID        uint
+	Operation Operation
+	Sec       string
+	PType     string
+	// Rule is the added or removed rule, or the new rule of an update.
+	Rule []string
+	// OldRule is the rule replaced by an update or removed by a save.
+	OldRule []string
+	// FieldIndex is the field index of filtered operations.
+	FieldIndex int
+	Actor      string
+	CreatedAt  time.Time
+}
+
+// AuditQuery selects the entries returned by ListAuditEntries. Empty fields match every entry.
+type AuditQuery struct {
+	PType string
+	// Rule matches the entries whose rule or old rule equals it.
+	Rule  []string
+	Actor string
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of returned entries, 0 means no limit.
+	Limit int
+}
+
+// auditRow is a row of the audit table.
+type auditRow struct {
+	ID         uint      `orm:"id"`
+	Op         string    `orm:"op"`
+	Sec        string    `orm:"sec"`
+	PType      string    `orm:"p_type"`
+	Rule       string    `orm:"rule"`
+	OldRule    string    `orm:"old_rule"`
+	FieldIndex int       `orm:"field_index"`
+	Actor      string    `orm:"actor"`
+	CreatedAt  time.Time `orm:"created_at"`
+	Tenant     string    `orm:"tenant_id"`
+}
+
+// WithAudit records every policy mutation made through the adapter in an audit table next to the policy table,
+// within the same transaction. actorFunc, which may be nil, extracts the actor from the context of the mutation.
+func WithAudit(actorFunc ActorFunc) Option {
+	return func(a *Adapter) {
+		a.audit = &auditor{actorFunc: actorFunc}
+	}
+}
+
+// openAudit creates the audit table if needed and starts recording the policy mutations.
+func (a *Adapter) openAudit() error {
+	a.audit.tableName = a.tableName + auditTableSuffix
+	if a.autoCreateTable {
+		if err := a.createTableDef(a.ctx, auditTable(a.audit.tableName)); err != nil {
+			return err
+		}
+		// Audit tables created before the tenant column.
+		if err := a.addTableColumn(a.ctx, a.audit.tableName, tenantColumnDef); err != nil {
+			return err
+		}
+	}
+	a.addWriteHook(a.audit.record)
+	return nil
+}
+
+// encodeRule encodes a rule for the audit table, an empty rule is stored as an empty string.
+func encodeRule(rule []string) (string, error) {
+	if len(rule) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(rule)
+	return string(data), err
+}
+
+// record inserts a row per changed rule within the transaction of a policy mutation.
+func (au *auditor) record(ctx context.Context, tx gdb.TX, change *policyChange) error {
+	actor := ""
+	if au.actorFunc != nil {
+		actor = au.actorFunc(ctx)
+	}
+	now := time.Now()
+	var rows []g.Map
+	add := func(sec, ptype string, rule, oldRule []string) error {
+		encodedRule, err := encodeRule(rule)
+		if err != nil {
+			return err
+		}
+		encodedOldRule, err := encodeRule(oldRule)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, g.Map{
+			"op":          string(change.op),
+			"sec":         sec,
+			"p_type":      ptype,
+			"rule":        encodedRule,
+			"old_rule":    encodedOldRule,
+			"field_index": change.fieldIndex,
+			"actor":       actor,
+			"created_at":  now,
+			tenantColumn:  change.tenant,
+		})
+		return nil
+	}
+
+	var err error
+	switch change.op {
+	case OpUpdatePolicies:
+		for i := range change.rules {
+			if err = add(change.sec, change.ptype, change.rules[i], change.oldRules[i]); err != nil {
+				return err
+			}
+		}
+	case OpSavePolicy:
+		// The rules of a save are preceded by their section and type.
+		for _, oldRule := range change.oldRules {
+			if err = add(oldRule[0], oldRule[1], nil, oldRule[2:]); err != nil {
+				return err
+			}
+		}
+		for _, rule := range change.rules {
+			if err = add(rule[0], rule[1], rule[2:], nil); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, oldRule := range change.oldRules {
+			if err = add(change.sec, change.ptype, nil, oldRule); err != nil {
+				return err
+			}
+		}
+		for _, rule := range change.rules {
+			if err = add(change.sec, change.ptype, rule, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	_, err = tx.Model(au.tableName).Data(rows).Insert()
+	return err
+}
+
+// ListAuditEntries returns the audit entries matching the query, most recent first.
+// With WithTenant or WithTablePerTenant, only the entries of the tenant of ctx are returned.
+func (a *Adapter) ListAuditEntries(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	if a.audit == nil {
+		return nil, errors.New("audit is not enabled")
+	}
+	tenant, err := a.changeTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db := a.route(a.db.Model(a.audit.tableName).Ctx(a.txCtx(ctx)).Where(tenantColumn, tenant)).Safe()
+	if query.PType != "" {
+		db = db.Where("p_type", query.PType)
+	}
+	if len(query.Rule) > 0 {
+		rule, err := encodeRule(query.Rule)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(db.Builder().Where("rule", rule).WhereOr("old_rule", rule))
+	}
+	if query.Actor != "" {
+		db = db.Where("actor", query.Actor)
+	}
+	if !query.Since.IsZero() {
+		db = db.WhereGTE("created_at", query.Since)
+	}
+	if !query.Until.IsZero() {
+		db = db.WhereLT("created_at", query.Until)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+
+	var rows []auditRow
+	if err := db.OrderDesc("id").Scan(&rows); err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := AuditEntry{
+			ID:         row.ID,
+			Operation:  Operation(row.Op),
+			Sec:        row.Sec,
+			PType:      row.PType,
+			FieldIndex: row.FieldIndex,
+			Actor:      row.Actor,
+			CreatedAt:  row.CreatedAt,
+		}
+		if row.Rule != "" {
+			if err := json.Unmarshal([]byte(row.Rule), &entry.Rule); err != nil {
+				return nil, err
+			}
+		}
+		if row.OldRule != "" {
+			if err := json.Unmarshal([]byte(row.OldRule), &entry.OldRule); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,122 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type actorKey struct{}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithAudit(func(ctx context.Context) string {
+		actor, _ := ctx.Value(actorKey{}).(string)
+		return actor
+	}))
+	assert.Nil(t, err)
+	_ = a.truncateTable()
+	_, _ = a.db.Exec(ctx, a.dialect.truncateTableSQL(a.audit.tableName))
+
+	aliceCtx := context.WithValue(ctx, actorKey{}, "admin-alice")
+	bobCtx := context.WithValue(ctx, actorKey{}, "admin-bob")
+	assert.Nil(t, a.AddPoliciesCtx(aliceCtx, "p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}))
+	assert.Nil(t, a.UpdatePolicyCtx(bobCtx, "p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}))
+	assert.Nil(t, a.RemovePolicyCtx(bobCtx, "p", "p", []string{"bob", "data2", "write"}))
+
+	entries, err := a.ListAuditEntries(ctx, AuditQuery{Actor: "admin-bob"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, OpRemovePolicies, entries[0].Operation)
+	assert.Equal(t, []string{"bob", "data2", "write"}, entries[0].Rule)
+	assert.Equal(t, OpUpdatePolicies, entries[1].Operation)
+	assert.Equal(t, []string{"alice", "data1", "write"}, entries[1].Rule)
+	assert.Equal(t, []string{"alice", "data1", "read"}, entries[1].OldRule)
+
+	// Both the grant and the update of the old rule are found by rule.
+	entries, err = a.ListAuditEntries(ctx, AuditQuery{PType: "p", Rule: []string{"alice", "data1", "read"}})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "admin-bob", entries[0].Actor)
+	assert.Equal(t, "admin-alice", entries[1].Actor)
+	assert.Equal(t, OpAddPolicies, entries[1].Operation)
+
+	// Changes made through an enforcer are audited too.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	_, err = e.AddPolicy("carol", "data3", "read")
+	assert.Nil(t, err)
+	entries, err = a.ListAuditEntries(ctx, AuditQuery{Rule: []string{"carol", "data3", "read"}, Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "", entries[0].Actor)
+
+	// Filtered removals record every removed rule.
+	_, err = e.RemoveFilteredPolicy(0, "carol")
+	assert.Nil(t, err)
+	entries, err = a.ListAuditEntries(ctx, AuditQuery{Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, OpRemoveFilteredPolicy, entries[0].Operation)
+	assert.Equal(t, []string{"carol", "data3", "read"}, entries[0].Rule)
+
+	// Saves record the added and removed rules.
+	assert.Nil(t, e.GetModel().AddPolicy("p", "p", []string{"dave", "data4", "read"}))
+	_, err = e.GetModel().RemovePolicy("p", "p", []string{"alice", "data1", "write"})
+	assert.Nil(t, err)
+	assert.Nil(t, e.SavePolicy())
+	entries, err = a.ListAuditEntries(ctx, AuditQuery{Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, OpSavePolicy, entries[0].Operation)
+	assert.Equal(t, "p", entries[0].PType)
+	assert.Equal(t, "p", entries[0].Sec)
+	assert.Equal(t, []string{"dave", "data4", "read"}, entries[0].Rule)
+	assert.Nil(t, entries[0].OldRule)
+	assert.Equal(t, OpSavePolicy, entries[1].Operation)
+	assert.Equal(t, []string{"alice", "data1", "write"}, entries[1].OldRule)
+	assert.Nil(t, entries[1].Rule)
+
+	// Adapters without audit refuse to list entries.
+	plain, err := NewAdapter(ctx, gdb.DefaultGroupName)
+	assert.Nil(t, err)
+	_, err = plain.ListAuditEntries(ctx, AuditQuery{})
+	assert.NotNil(t, err)
+	cleanPolicy(ctx, a)
+}
+
+func TestAuditTenant(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_tenant_audit"), WithTenant(contextTenant), WithAudit(nil))
+	assert.Nil(t, err)
+	defer func() {
+		_, _ = a.db.Exec(ctx, a.dialect.dropTableSQL(a.audit.tableName))
+		_ = a.dropTable()
+	}()
+	ctx1 := context.WithValue(ctx, tenantKey{}, "tenant1")
+	ctx2 := context.WithValue(ctx, tenantKey{}, "tenant2")
+
+	assert.Nil(t, a.AddPolicyCtx(ctx1, "p", "p", []string{"alice", "data1", "read"}))
+	assert.Nil(t, a.AddPolicyCtx(ctx2, "p", "p", []string{"bob", "data2", "write"}))
+	entries, err := a.ListAuditEntries(ctx1, AuditQuery{})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []string{"alice", "data1", "read"}, entries[0].Rule)
+
+	_, err = a.ListAuditEntries(ctx, AuditQuery{})
+	assert.True(t, errors.Is(err, ErrNoTenant))
+}
+
+func TestSetSaved(t *testing.T) {
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	assert.Nil(t, err)
+	change := &policyChange{op: OpSavePolicy}
+	added := []CasbinRule{{PType: "g", V0: "alice", V1: "admin"}}
+	removed := []CasbinRule{{PType: "p", V0: "bob", V1: "data2", V2: "write"}, {PType: "", V0: "carol"}}
+	assert.Nil(t, change.setSaved(ruleLayout{}, m, added, removed))
+	assert.Equal(t, [][]string{{"g", "g", "alice", "admin"}}, change.rules)
+	assert.Equal(t, [][]string{{"p", "p", "bob", "data2", "write"}, {"", "", "carol"}}, change.oldRules)
+}
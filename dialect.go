@@ -0,0 +1,474 @@
+package gdbadapter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dialect generates the SQL statements that differ between database types.
+type dialect interface {
+	// quote quotes a possibly schema-qualified identifier.
+	quote(identifier string) string
+	// columnType returns the column type declaration of the column.
+	columnType(column columnDef) string
+	// createTableSQL returns the statements creating the table and its indexes.
+	createTableSQL(table tableDef) []string
+	// truncateTableSQL returns the statement removing every row of the table.
+	truncateTableSQL(tableName string) string
+	// dropTableSQL returns the statement dropping the table.
+	dropTableSQL(tableName string) string
+	// insertIgnoreSQL returns the statement inserting one row with a placeholder per column,
+	// doing nothing when the row violates the unique key over keys.
+	insertIgnoreSQL(tableName string, columns, keys []string) string
+	// addColumnSQL returns the statement adding the column to the table.
+	addColumnSQL(tableName string, column columnDef) string
+	// alterColumnSQL returns the statement changing the type and nullability of the column, or "" if they need no change.
+	alterColumnSQL(tableName string, column columnDef) string
+	// hasColumnSQL returns the query counting the columns of the table with the given name.
+	hasColumnSQL(tableName, columnName string) (string, []interface{})
+	// hasIndexSQL returns the query counting the indexes of the table with the given name.
+	hasIndexSQL(tableName, indexName string) (string, []interface{})
+	// dropIndexSQL returns the statement dropping the index of the table.
+	dropIndexSQL(tableName, indexName string) string
+	// isDuplicateError reports whether err is a unique key violation.
+	isDuplicateError(err error) bool
+}
+
+// newDialect returns the dialect for the gf database type.
+func newDialect(dbType string) (dialect, error) {
+	switch strings.ToLower(dbType) {
+	case "mysql", "mariadb", "tidb":
+		return mysqlDialect{}, nil
+	case "pgsql", "postgres", "postgresql":
+		return pgsqlDialect{}, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	case "mssql", "sqlserver":
+		return mssqlDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database type %q", dbType)
+	}
+}
+
+// quoteWith quotes every dot separated part of identifier with the given quote characters.
+func quoteWith(identifier, left, right string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = left + part + right
+	}
+	return strings.Join(parts, ".")
+}
+
+// errorContains reports whether the message of err contains any of the substrings.
+func errorContains(err error, substrings ...string) bool {
+	if err == nil {
+		return false
+	}
+	message := err.Error()
+	for _, substring := range substrings {
+		if strings.Contains(message, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholders returns n comma separated placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// quoteList returns the quoted columns joined by commas.
+func quoteList(d dialect, columns []string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, d.quote(column))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// columnDefinition returns the full definition of the column, including its constraints.
+func columnDefinition(d dialect, column columnDef) string {
+	definition := d.quote(column.name) + " " + d.columnType(column)
+	if column.typ == columnAutoID {
+		return definition
+	}
+	if column.notNull {
+		definition += " NOT NULL"
+	}
+	if column.defaultValue != "" {
+		definition += " DEFAULT " + column.defaultValue
+	}
+	if column.primaryKey {
+		definition += " PRIMARY KEY"
+	}
+	return definition
+}
+
+// createIndexStatement returns the CREATE INDEX statement of the index, supported as is by every dialect.
+func createIndexStatement(d dialect, tableName string, index indexDef) string {
+	unique := ""
+	if index.unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, d.quote(index.name), d.quote(tableName), quoteList(d, index.columns))
+}
+
+// unqualified returns the table name without its schema.
+func unqualified(tableName string) string {
+	return tableName[strings.LastIndex(tableName, ".")+1:]
+}
+
+// createIndexSQL returns the CREATE INDEX statements of the table for dialects supporting IF NOT EXISTS.
+func createIndexSQL(d dialect, table tableDef) []string {
+	var statements []string
+	for _, index := range table.indexes {
+		unique := ""
+		if index.unique {
+			unique = "UNIQUE "
+		}
+		statements = append(statements, fmt.Sprintf(
+			"CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+			unique, d.quote(index.name), d.quote(table.name), quoteList(d, index.columns),
+		))
+	}
+	return statements
+}
+
+type mysqlDialect struct{}
+
+func (d mysqlDialect) quote(identifier string) string {
+	return quoteWith(identifier, "`", "`")
+}
+
+func (d mysqlDialect) columnType(column columnDef) string {
+	switch column.typ {
+	case columnAutoID:
+		return "bigint unsigned NOT NULL AUTO_INCREMENT"
+	case columnInt:
+		return "INT"
+	case columnBigint:
+		return "BIGINT"
+	case columnVarchar:
+		return fmt.Sprintf("VARCHAR(%d)", column.size)
+	case columnText:
+		return "TEXT"
+	default:
+		return "DATETIME"
+	}
+}
+
+// createTableSQL declares the primary key and the indexes inline, as MySQL has no CREATE INDEX IF NOT EXISTS.
+func (d mysqlDialect) createTableSQL(table tableDef) []string {
+	var (
+		definitions []string
+		primaryKey  string
+	)
+	for _, column := range table.columns {
+		if column.typ == columnAutoID || column.primaryKey {
+			primaryKey = column.name
+			column.primaryKey = false
+		}
+		definitions = append(definitions, columnDefinition(d, column))
+	}
+	if primaryKey != "" {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", d.quote(primaryKey)))
+	}
+	for _, index := range table.indexes {
+		key := "KEY"
+		if index.unique {
+			key = "UNIQUE KEY"
+		}
+		definitions = append(definitions, fmt.Sprintf("%s %s (%s)", key, d.quote(index.name), quoteList(d, index.columns)))
+	}
+	return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", d.quote(table.name), strings.Join(definitions, ","))}
+}
+
+func (d mysqlDialect) truncateTableSQL(tableName string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s", d.quote(tableName))
+}
+
+func (d mysqlDialect) dropTableSQL(tableName string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", d.quote(tableName))
+}
+
+func (d mysqlDialect) insertIgnoreSQL(tableName string, columns, keys []string) string {
+	return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s)", d.quote(tableName), quoteList(d, columns), placeholders(len(columns)))
+}
+
+func (d mysqlDialect) addColumnSQL(tableName string, column columnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", d.quote(tableName), columnDefinition(d, column))
+}
+
+func (d mysqlDialect) alterColumnSQL(tableName string, column columnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", d.quote(tableName), columnDefinition(d, column))
+}
+
+func (d mysqlDialect) hasColumnSQL(tableName, columnName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?",
+		[]interface{}{unqualified(tableName), columnName}
+}
+
+func (d mysqlDialect) hasIndexSQL(tableName, indexName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+		[]interface{}{unqualified(tableName), indexName}
+}
+
+func (d mysqlDialect) dropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", d.quote(indexName), d.quote(tableName))
+}
+
+func (d mysqlDialect) isDuplicateError(err error) bool {
+	return errorContains(err, "Error 1062", "Duplicate entry")
+}
+
+type pgsqlDialect struct{}
+
+func (d pgsqlDialect) quote(identifier string) string {
+	return quoteWith(identifier, `"`, `"`)
+}
+
+func (d pgsqlDialect) columnType(column columnDef) string {
+	switch column.typ {
+	case columnAutoID:
+		return "BIGSERIAL PRIMARY KEY"
+	case columnInt:
+		return "INTEGER"
+	case columnBigint:
+		return "BIGINT"
+	case columnVarchar:
+		return fmt.Sprintf("VARCHAR(%d)", column.size)
+	case columnText:
+		return "TEXT"
+	default:
+		return "TIMESTAMP"
+	}
+}
+
+func (d pgsqlDialect) createTableSQL(table tableDef) []string {
+	definitions := make([]string, 0, len(table.columns))
+	for _, column := range table.columns {
+		definitions = append(definitions, columnDefinition(d, column))
+	}
+	statements := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", d.quote(table.name), strings.Join(definitions, ","))}
+	return append(statements, createIndexSQL(d, table)...)
+}
+
+func (d pgsqlDialect) truncateTableSQL(tableName string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s", d.quote(tableName))
+}
+
+func (d pgsqlDialect) dropTableSQL(tableName string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", d.quote(tableName))
+}
+
+func (d pgsqlDialect) insertIgnoreSQL(tableName string, columns, keys []string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING", d.quote(tableName), quoteList(d, columns), placeholders(len(columns)))
+}
+
+func (d pgsqlDialect) addColumnSQL(tableName string, column columnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", d.quote(tableName), columnDefinition(d, column))
+}
+
+func (d pgsqlDialect) alterColumnSQL(tableName string, column columnDef) string {
+	statement := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", d.quote(tableName), d.quote(column.name), d.columnType(column))
+	if column.notNull {
+		statement += fmt.Sprintf(", ALTER COLUMN %s SET NOT NULL", d.quote(column.name))
+	}
+	return statement
+}
+
+func (d pgsqlDialect) hasColumnSQL(tableName, columnName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE table_name = ? AND column_name = ?", []interface{}{unqualified(tableName), columnName}
+}
+
+func (d pgsqlDialect) hasIndexSQL(tableName, indexName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM pg_indexes WHERE tablename = ? AND indexname = ?", []interface{}{unqualified(tableName), indexName}
+}
+
+// dropIndexSQL qualifies the index with the schema of the table, as indexes belong to schemas.
+func (d pgsqlDialect) dropIndexSQL(tableName, indexName string) string {
+	if i := strings.LastIndex(tableName, "."); i >= 0 {
+		indexName = tableName[:i+1] + indexName
+	}
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s", d.quote(indexName))
+}
+
+func (d pgsqlDialect) isDuplicateError(err error) bool {
+	return errorContains(err, "SQLSTATE 23505", "duplicate key value violates unique constraint")
+}
+
+type sqliteDialect struct{}
+
+func (d sqliteDialect) quote(identifier string) string {
+	return quoteWith(identifier, `"`, `"`)
+}
+
+func (d sqliteDialect) columnType(column columnDef) string {
+	switch column.typ {
+	case columnAutoID:
+		return "INTEGER PRIMARY KEY AUTOINCREMENT"
+	case columnInt, columnBigint:
+		return "INTEGER"
+	case columnVarchar:
+		return fmt.Sprintf("VARCHAR(%d)", column.size)
+	case columnText:
+		return "TEXT"
+	default:
+		return "DATETIME"
+	}
+}
+
+func (d sqliteDialect) createTableSQL(table tableDef) []string {
+	definitions := make([]string, 0, len(table.columns))
+	for _, column := range table.columns {
+		definitions = append(definitions, columnDefinition(d, column))
+	}
+	statements := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", d.quote(table.name), strings.Join(definitions, ","))}
+	return append(statements, createIndexSQL(d, table)...)
+}
+
+// truncateTableSQL uses DELETE as SQLite has no TRUNCATE statement.
+func (d sqliteDialect) truncateTableSQL(tableName string) string {
+	return fmt.Sprintf("DELETE FROM %s", d.quote(tableName))
+}
+
+func (d sqliteDialect) dropTableSQL(tableName string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", d.quote(tableName))
+}
+
+func (d sqliteDialect) insertIgnoreSQL(tableName string, columns, keys []string) string {
+	return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", d.quote(tableName), quoteList(d, columns), placeholders(len(columns)))
+}
+
+// addColumnSQL drops the default of timestamp columns, as SQLite cannot add a column with a non-constant default.
+func (d sqliteDialect) addColumnSQL(tableName string, column columnDef) string {
+	if column.typ == columnTimestamp {
+		column.defaultValue = ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", d.quote(tableName), columnDefinition(d, column))
+}
+
+// alterColumnSQL returns "", as SQLite does not enforce the length of VARCHAR columns
+// and cannot make a column NOT NULL, leaving the migrated rule_hash nullable.
+func (d sqliteDialect) alterColumnSQL(tableName string, column columnDef) string {
+	return ""
+}
+
+func (d sqliteDialect) hasColumnSQL(tableName, columnName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", []interface{}{unqualified(tableName), columnName}
+}
+
+func (d sqliteDialect) hasIndexSQL(tableName, indexName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?", []interface{}{unqualified(tableName), indexName}
+}
+
+func (d sqliteDialect) dropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s", d.quote(indexName))
+}
+
+func (d sqliteDialect) isDuplicateError(err error) bool {
+	return errorContains(err, "UNIQUE constraint failed")
+}
+
+type mssqlDialect struct{}
+
+func (d mssqlDialect) quote(identifier string) string {
+	return quoteWith(identifier, "[", "]")
+}
+
+func (d mssqlDialect) columnType(column columnDef) string {
+	switch column.typ {
+	case columnAutoID:
+		return "BIGINT IDENTITY(1,1) PRIMARY KEY"
+	case columnInt:
+		return "INT"
+	case columnBigint:
+		return "BIGINT"
+	case columnVarchar:
+		return fmt.Sprintf("NVARCHAR(%d)", column.size)
+	case columnText:
+		return "NVARCHAR(MAX)"
+	default:
+		return "DATETIME2"
+	}
+}
+
+// createTableSQL guards every statement as SQL Server has no IF NOT EXISTS for tables and indexes.
+func (d mssqlDialect) createTableSQL(table tableDef) []string {
+	definitions := make([]string, 0, len(table.columns))
+	for _, column := range table.columns {
+		definitions = append(definitions, columnDefinition(d, column))
+	}
+	statements := []string{fmt.Sprintf(
+		"IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s (%s)",
+		table.name, d.quote(table.name), strings.Join(definitions, ","),
+	)}
+	for _, index := range table.indexes {
+		unique := ""
+		if index.unique {
+			unique = "UNIQUE "
+		}
+		statements = append(statements, fmt.Sprintf(
+			"IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = N'%s' AND object_id = OBJECT_ID(N'%s')) CREATE %sINDEX %s ON %s (%s)",
+			index.name, table.name, unique, d.quote(index.name), d.quote(table.name), quoteList(d, index.columns),
+		))
+	}
+	return statements
+}
+
+func (d mssqlDialect) truncateTableSQL(tableName string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s", d.quote(tableName))
+}
+
+func (d mssqlDialect) dropTableSQL(tableName string) string {
+	return fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NOT NULL DROP TABLE %s", tableName, d.quote(tableName))
+}
+
+// insertIgnoreSQL merges the row on the key columns, as SQL Server has no INSERT IGNORE.
+func (d mssqlDialect) insertIgnoreSQL(tableName string, columns, keys []string) string {
+	var (
+		selected   = make([]string, 0, len(columns))
+		conditions = make([]string, 0, len(keys))
+		values     = make([]string, 0, len(columns))
+	)
+	for _, column := range columns {
+		selected = append(selected, "? AS "+d.quote(column))
+		values = append(values, "source."+d.quote(column))
+	}
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("target.%s = source.%s", d.quote(key), d.quote(key)))
+	}
+	return fmt.Sprintf(
+		"MERGE INTO %s WITH (HOLDLOCK) AS target USING (SELECT %s) AS source ON %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);",
+		d.quote(tableName), strings.Join(selected, ","), strings.Join(conditions, " AND "), quoteList(d, columns), strings.Join(values, ","),
+	)
+}
+
+func (d mssqlDialect) addColumnSQL(tableName string, column columnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s", d.quote(tableName), columnDefinition(d, column))
+}
+
+func (d mssqlDialect) alterColumnSQL(tableName string, column columnDef) string {
+	statement := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", d.quote(tableName), d.quote(column.name), d.columnType(column))
+	if column.notNull {
+		statement += " NOT NULL"
+	}
+	return statement
+}
+
+func (d mssqlDialect) hasColumnSQL(tableName, columnName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM sys.columns WHERE name = ? AND object_id = OBJECT_ID(?)", []interface{}{columnName, tableName}
+}
+
+func (d mssqlDialect) hasIndexSQL(tableName, indexName string) (string, []interface{}) {
+	return "SELECT COUNT(*) FROM sys.indexes WHERE name = ? AND object_id = OBJECT_ID(?)", []interface{}{indexName, tableName}
+}
+
+func (d mssqlDialect) dropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", d.quote(indexName), d.quote(tableName))
+}
+
+func (d mssqlDialect) isDuplicateError(err error) bool {
+	return errorContains(err, "Cannot insert duplicate key")
+}
@@ -0,0 +1,168 @@
+package gdbadapter
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewDialect(t *testing.T) {
+	for dbType, want := range map[string]dialect{
+		"mysql":  mysqlDialect{},
+		"tidb":   mysqlDialect{},
+		"pgsql":  pgsqlDialect{},
+		"sqlite": sqliteDialect{},
+		"mssql":  mssqlDialect{},
+	} {
+		d, err := newDialect(dbType)
+		assert.Nil(t, err)
+		assert.Equal(t, want, d, dbType)
+	}
+
+	_, err := newDialect("oracle")
+	assert.NotNil(t, err)
+}
+
+func TestDialectQuote(t *testing.T) {
+	assert.Equal(t, "`casbin_rule`", mysqlDialect{}.quote("casbin_rule"))
+	assert.Equal(t, `"public"."casbin_rule"`, pgsqlDialect{}.quote("public.casbin_rule"))
+	assert.Equal(t, `"casbin_rule"`, sqliteDialect{}.quote("casbin_rule"))
+	assert.Equal(t, "[dbo].[casbin_rule]", mssqlDialect{}.quote("dbo.casbin_rule"))
+}
+
+func TestDialectCreateTableSQL(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `sys_casbin_rule` (`id` bigint unsigned NOT NULL AUTO_INCREMENT,`p_type` VARCHAR(100),`v0` VARCHAR(100),`v1` VARCHAR(100),`v2` VARCHAR(100),`v3` VARCHAR(100),`v4` VARCHAR(100),`v5` VARCHAR(100),`v6` VARCHAR(25),`v7` VARCHAR(25),PRIMARY KEY (`id`),UNIQUE KEY `idx_sys_casbin_rule` (`p_type`,`v0`,`v1`,`v2`,`v3`,`v4`,`v5`,`v6`,`v7`))",
+	}, mysqlDialect{}.createTableSQL(ruleTable("sys_casbin_rule", ruleLayout{})))
+
+	assert.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "casbin_rule" ("id" BIGSERIAL PRIMARY KEY,"p_type" VARCHAR(100),"v0" VARCHAR(100),"v1" VARCHAR(100),"v2" VARCHAR(100),"v3" VARCHAR(100),"v4" VARCHAR(100),"v5" VARCHAR(100),"v6" VARCHAR(25),"v7" VARCHAR(25))`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "idx_casbin_rule" ON "casbin_rule" ("p_type","v0","v1","v2","v3","v4","v5","v6","v7")`,
+	}, pgsqlDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{})))
+
+	assert.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "casbin_rule" ("id" INTEGER PRIMARY KEY AUTOINCREMENT,"p_type" VARCHAR(100),"v0" VARCHAR(100),"v1" VARCHAR(100),"v2" VARCHAR(100),"v3" VARCHAR(100),"v4" VARCHAR(100),"v5" VARCHAR(100),"v6" VARCHAR(25),"v7" VARCHAR(25))`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "idx_casbin_rule" ON "casbin_rule" ("p_type","v0","v1","v2","v3","v4","v5","v6","v7")`,
+	}, sqliteDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{})))
+
+	assert.Equal(t, []string{
+		"IF OBJECT_ID(N'casbin_rule', N'U') IS NULL CREATE TABLE [casbin_rule] ([id] BIGINT IDENTITY(1,1) PRIMARY KEY,[p_type] NVARCHAR(100),[v0] NVARCHAR(100),[v1] NVARCHAR(100),[v2] NVARCHAR(100),[v3] NVARCHAR(100),[v4] NVARCHAR(100),[v5] NVARCHAR(100),[v6] NVARCHAR(25),[v7] NVARCHAR(25))",
+		"IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = N'idx_casbin_rule' AND object_id = OBJECT_ID(N'casbin_rule')) CREATE UNIQUE INDEX [idx_casbin_rule] ON [casbin_rule] ([p_type],[v0],[v1],[v2],[v3],[v4],[v5],[v6],[v7])",
+	}, mssqlDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{})))
+}
+
+func TestDialectTruncateTableSQL(t *testing.T) {
+	assert.Equal(t, "TRUNCATE TABLE `casbin_rule`", mysqlDialect{}.truncateTableSQL("casbin_rule"))
+	assert.Equal(t, `TRUNCATE TABLE "casbin_rule"`, pgsqlDialect{}.truncateTableSQL("casbin_rule"))
+	assert.Equal(t, `DELETE FROM "casbin_rule"`, sqliteDialect{}.truncateTableSQL("casbin_rule"))
+	assert.Equal(t, "TRUNCATE TABLE [casbin_rule]", mssqlDialect{}.truncateTableSQL("casbin_rule"))
+}
+
+func TestDialectCreateRevisionTableSQL(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `casbin_rule_revision` (`id` INT NOT NULL,`revision` BIGINT NOT NULL DEFAULT 0,`updated_by` VARCHAR(64),PRIMARY KEY (`id`))",
+	}, mysqlDialect{}.createTableSQL(revisionTable("casbin_rule_revision")))
+
+	assert.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "casbin_rule_revision" ("id" INTEGER NOT NULL PRIMARY KEY,"revision" BIGINT NOT NULL DEFAULT 0,"updated_by" VARCHAR(64))`,
+	}, pgsqlDialect{}.createTableSQL(revisionTable("casbin_rule_revision")))
+
+	assert.Equal(t, []string{
+		"IF OBJECT_ID(N'casbin_rule_revision', N'U') IS NULL CREATE TABLE [casbin_rule_revision] ([id] INT NOT NULL PRIMARY KEY,[revision] BIGINT NOT NULL DEFAULT 0,[updated_by] NVARCHAR(64))",
+	}, mssqlDialect{}.createTableSQL(revisionTable("casbin_rule_revision")))
+}
+
+func TestDialectCreateLogTableSQL(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `casbin_rule_log` (`seq` BIGINT NOT NULL,`op` VARCHAR(32) NOT NULL,`sec` VARCHAR(16),`p_type` VARCHAR(100),`rules` TEXT,`old_rules` TEXT,`field_index` INT,`field_values` TEXT,`created_by` VARCHAR(64),`created_at` DATETIME,`tenant_id` VARCHAR(64) NOT NULL DEFAULT '',PRIMARY KEY (`seq`),KEY `idx_casbin_rule_log_created_at` (`created_at`))",
+	}, mysqlDialect{}.createTableSQL(logTable("casbin_rule_log")))
+
+	assert.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "casbin_rule_log" ("seq" BIGINT NOT NULL PRIMARY KEY,"op" VARCHAR(32) NOT NULL,"sec" VARCHAR(16),"p_type" VARCHAR(100),"rules" TEXT,"old_rules" TEXT,"field_index" INTEGER,"field_values" TEXT,"created_by" VARCHAR(64),"created_at" TIMESTAMP,"tenant_id" VARCHAR(64) NOT NULL DEFAULT '')`,
+		`CREATE INDEX IF NOT EXISTS "idx_casbin_rule_log_created_at" ON "casbin_rule_log" ("created_at")`,
+	}, pgsqlDialect{}.createTableSQL(logTable("casbin_rule_log")))
+}
+
+func TestDialectIsDuplicateError(t *testing.T) {
+	assert.True(t, mysqlDialect{}.isDuplicateError(errors.New("Error 1062 (23000): Duplicate entry 'p-alice' for key 'idx_casbin_rule'")))
+	assert.True(t, pgsqlDialect{}.isDuplicateError(errors.New(`ERROR: duplicate key value violates unique constraint "idx_casbin_rule" (SQLSTATE 23505)`)))
+	assert.True(t, sqliteDialect{}.isDuplicateError(errors.New("UNIQUE constraint failed: casbin_rule.p_type")))
+	assert.True(t, mssqlDialect{}.isDuplicateError(errors.New("mssql: Cannot insert duplicate key row in object 'dbo.casbin_rule'")))
+	assert.False(t, mysqlDialect{}.isDuplicateError(errors.New("Error 1146: Table 'casbin_rule' doesn't exist")))
+	assert.False(t, mysqlDialect{}.isDuplicateError(nil))
+}
+
+func TestDialectInsertIgnoreSQL(t *testing.T) {
+	columns := []string{"p_type", "v0"}
+	assert.Equal(t, "INSERT IGNORE INTO `casbin_rule` (`p_type`,`v0`) VALUES (?,?)", mysqlDialect{}.insertIgnoreSQL("casbin_rule", columns, columns))
+	assert.Equal(t, `INSERT INTO "casbin_rule" ("p_type","v0") VALUES (?,?) ON CONFLICT DO NOTHING`, pgsqlDialect{}.insertIgnoreSQL("casbin_rule", columns, columns))
+	assert.Equal(t, `INSERT OR IGNORE INTO "casbin_rule" ("p_type","v0") VALUES (?,?)`, sqliteDialect{}.insertIgnoreSQL("casbin_rule", columns, columns))
+	assert.Equal(t,
+		"MERGE INTO [casbin_rule] WITH (HOLDLOCK) AS target USING (SELECT ? AS [p_type],? AS [v0]) AS source ON target.[p_type] = source.[p_type] AND target.[v0] = source.[v0] WHEN NOT MATCHED THEN INSERT ([p_type],[v0]) VALUES (source.[p_type],source.[v0]);",
+		mssqlDialect{}.insertIgnoreSQL("casbin_rule", columns, columns),
+	)
+}
+
+func TestDialectCreateOverflowTableSQL(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `casbin_rule` (`id` bigint unsigned NOT NULL AUTO_INCREMENT,`p_type` VARCHAR(100),`v0` VARCHAR(100),`v1` VARCHAR(100),`v2` VARCHAR(100),`v3` VARCHAR(100),`v4` VARCHAR(100),`v5` VARCHAR(100),`v6` VARCHAR(100),`v7` VARCHAR(100),`v_extra` TEXT,`rule_hash` VARCHAR(64) NOT NULL,PRIMARY KEY (`id`),UNIQUE KEY `idx_casbin_rule_rule_hash` (`rule_hash`))",
+	}, mysqlDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{overflow: true, hash: true})))
+}
+
+func TestDialectCreateHashTableSQL(t *testing.T) {
+	assert.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "casbin_rule" ("id" BIGSERIAL PRIMARY KEY,"p_type" TEXT,"v0" TEXT,"v1" TEXT,"v2" TEXT,"v3" TEXT,"v4" TEXT,"v5" TEXT,"v6" TEXT,"v7" TEXT,"rule_hash" VARCHAR(64) NOT NULL)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "idx_casbin_rule_rule_hash" ON "casbin_rule" ("rule_hash")`,
+	}, pgsqlDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{hash: true, text: true})))
+	assert.Equal(t,
+		"MERGE INTO [casbin_rule] WITH (HOLDLOCK) AS target USING (SELECT ? AS [p_type],? AS [rule_hash]) AS source ON target.[rule_hash] = source.[rule_hash] WHEN NOT MATCHED THEN INSERT ([p_type],[rule_hash]) VALUES (source.[p_type],source.[rule_hash]);",
+		mssqlDialect{}.insertIgnoreSQL("casbin_rule", []string{"p_type", "rule_hash"}, []string{"rule_hash"}),
+	)
+}
+
+func TestDialectCreateTenantTableSQL(t *testing.T) {
+	statements := mysqlDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{hash: true, tenant: true}))
+	assert.Len(t, statements, 1)
+	assert.Contains(t, statements[0], "`tenant_id` VARCHAR(64) NOT NULL DEFAULT ''")
+	assert.Contains(t, statements[0], "UNIQUE KEY `idx_casbin_rule_tenant_rule_hash` (`tenant_id`,`rule_hash`)")
+	assert.Equal(t,
+		"INSERT IGNORE INTO `casbin_rule` (`p_type`,`rule_hash`,`tenant_id`) VALUES (?,?,?)",
+		mysqlDialect{}.insertIgnoreSQL("casbin_rule", []string{"p_type", "rule_hash", "tenant_id"}, []string{"tenant_id", "rule_hash"}),
+	)
+}
+
+func TestDialectMigrationSQL(t *testing.T) {
+	timestamp := columnDef{name: "created_at", typ: columnTimestamp, defaultValue: "CURRENT_TIMESTAMP"}
+	assert.Equal(t, "ALTER TABLE `casbin_rule` ADD COLUMN `created_at` DATETIME DEFAULT CURRENT_TIMESTAMP", mysqlDialect{}.addColumnSQL("casbin_rule", timestamp))
+	assert.Equal(t, `ALTER TABLE "casbin_rule" ADD COLUMN "created_at" DATETIME`, sqliteDialect{}.addColumnSQL("casbin_rule", timestamp))
+	assert.Equal(t, "ALTER TABLE [casbin_rule] ADD [created_at] DATETIME2 DEFAULT CURRENT_TIMESTAMP", mssqlDialect{}.addColumnSQL("casbin_rule", timestamp))
+
+	v6 := columnDef{name: "v6", typ: columnVarchar, size: 100}
+	assert.Equal(t, "ALTER TABLE `casbin_rule` MODIFY COLUMN `v6` VARCHAR(100)", mysqlDialect{}.alterColumnSQL("casbin_rule", v6))
+	assert.Equal(t, `ALTER TABLE "casbin_rule" ALTER COLUMN "v6" TYPE VARCHAR(100)`, pgsqlDialect{}.alterColumnSQL("casbin_rule", v6))
+	assert.Equal(t, "", sqliteDialect{}.alterColumnSQL("casbin_rule", v6))
+	assert.Equal(t, "ALTER TABLE [casbin_rule] ALTER COLUMN [v6] NVARCHAR(100)", mssqlDialect{}.alterColumnSQL("casbin_rule", v6))
+	hash := columnDef{name: "rule_hash", typ: columnVarchar, size: 64, notNull: true}
+	assert.Equal(t, "ALTER TABLE `casbin_rule` MODIFY COLUMN `rule_hash` VARCHAR(64) NOT NULL", mysqlDialect{}.alterColumnSQL("casbin_rule", hash))
+	assert.Equal(t, `ALTER TABLE "casbin_rule" ALTER COLUMN "rule_hash" TYPE VARCHAR(64), ALTER COLUMN "rule_hash" SET NOT NULL`, pgsqlDialect{}.alterColumnSQL("casbin_rule", hash))
+	assert.Equal(t, "ALTER TABLE [casbin_rule] ALTER COLUMN [rule_hash] NVARCHAR(64) NOT NULL", mssqlDialect{}.alterColumnSQL("casbin_rule", hash))
+
+	assert.Equal(t, "DROP INDEX `idx_casbin_rule` ON `casbin_rule`", mysqlDialect{}.dropIndexSQL("casbin_rule", "idx_casbin_rule"))
+	assert.Equal(t, `DROP INDEX IF EXISTS "public"."idx_casbin_rule"`, pgsqlDialect{}.dropIndexSQL("public.casbin_rule", "idx_casbin_rule"))
+	query, args := mysqlDialect{}.hasIndexSQL("db.casbin_rule", "idx_casbin_rule")
+	assert.Contains(t, query, "information_schema.statistics")
+	assert.Equal(t, []interface{}{"casbin_rule", "idx_casbin_rule"}, args)
+	query, args = sqliteDialect{}.hasColumnSQL("casbin_rule", "v_extra")
+	assert.Contains(t, query, "pragma_table_info")
+	assert.Equal(t, []interface{}{"casbin_rule", "v_extra"}, args)
+}
+
+func TestDialectCreateMappedTableSQL(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `casbin_rule` (`id` bigint unsigned NOT NULL AUTO_INCREMENT,`ptype` VARCHAR(100),`v0` VARCHAR(100),`v1` VARCHAR(100),`v2` VARCHAR(100),`v3` VARCHAR(100),`v4` VARCHAR(100),`v5` VARCHAR(100),PRIMARY KEY (`id`),UNIQUE KEY `idx_casbin_rule` (`ptype`,`v0`,`v1`,`v2`,`v3`,`v4`,`v5`))",
+	}, mysqlDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{mapping: GormAdapterColumnMapping})))
+	assert.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "casbin_rule" ("p_type" VARCHAR(100),"v0" VARCHAR(100),"v1" VARCHAR(100),"v2" VARCHAR(100),"v3" VARCHAR(100),"v4" VARCHAR(100),"v5" VARCHAR(100))`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "idx_casbin_rule" ON "casbin_rule" ("p_type","v0","v1","v2","v3","v4","v5")`,
+	}, sqliteDialect{}.createTableSQL(ruleTable("casbin_rule", ruleLayout{mapping: XormAdapterColumnMapping})))
+}
@@ -0,0 +1,168 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"sort"
+	"strings"
+)
+
+// domainField is the position of the domain among the values of the rules of a policy type.
+type domainField struct {
+	sec   string
+	ptype string
+	index int
+}
+
+// filter returns the filter selecting the rules of the type in the domains.
+func (d domainField) filter(domains []string) Filter {
+	filter := Filter{PType: []string{d.ptype}}
+	fields := []*[]string{&filter.V0, &filter.V1, &filter.V2, &filter.V3, &filter.V4, &filter.V5, &filter.V6, &filter.V7}
+	*fields[d.index] = domains
+	return filter
+}
+
+// domainFields returns the domain fields of the policy types of the model, ordered by type.
+// The domain of a "p" type is its "dom" or "domain" token, the one of a "g" type its third token.
+func domainFields(m model.Model) ([]domainField, error) {
+	var fields []domainField
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			index := -1
+			if sec == "g" {
+				if len(ast.Tokens) > 2 {
+					index = 2
+				}
+			} else {
+				for i, token := range ast.Tokens {
+					if name := strings.TrimPrefix(token, ptype+"_"); name == "dom" || name == "domain" {
+						index = i
+						break
+					}
+				}
+			}
+			if index < 0 {
+				continue
+			}
+			if index > 7 {
+				return nil, fmt.Errorf("%w: no column for the domain of %s", ErrInvalidFilter, ptype)
+			}
+			fields = append(fields, domainField{sec: sec, ptype: ptype, index: index})
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("the model has no domain field")
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].ptype < fields[j].ptype
+	})
+	return fields, nil
+}
+
+// domainFilter returns the filter selecting the rules in the domains of every type with a domain field.
+func domainFilter(fields []domainField, domains []string) BatchFilter {
+	var batch BatchFilter
+	for _, field := range fields {
+		batch.Filters = append(batch.Filters, field.filter(domains))
+	}
+	return batch
+}
+
+// LoadDomainPolicy loads the rules in the domains into the model like LoadFilteredPolicy,
+// finding the domain of every policy type in the model definition.
+// The rules of the types without a domain field are not loaded.
+func (a *Adapter) LoadDomainPolicy(ctx context.Context, model model.Model, domains ...string) error {
+	fields, err := domainFields(model)
+	if err != nil {
+		return err
+	}
+	return a.LoadFilteredPolicyCtx(ctx, model, domainFilter(fields, domains))
+}
+
+// RemoveDomain removes the rules in the domain from the store in a single transaction.
+func (a *Adapter) RemoveDomain(ctx context.Context, model model.Model, domain string) error {
+	fields, err := domainFields(model)
+	if err != nil {
+		return err
+	}
+	return a.transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		for _, field := range fields {
+			if err := a.RemoveFilteredPolicyCtx(ctx, field.sec, field.ptype, field.index, domain); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CopyDomain copies the rules in the domain src to the domain dst in a single transaction,
+// skipping the rules already in dst.
+func (a *Adapter) CopyDomain(ctx context.Context, model model.Model, src, dst string) error {
+	fields, err := domainFields(model)
+	if err != nil {
+		return err
+	}
+	return a.transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		for _, field := range fields {
+			db := a.table(ctx, tx).Safe()
+			where, err := a.layout.filterWhere(db, field.filter([]string{src}))
+			if err != nil {
+				return err
+			}
+			result, err := db.Where(where).All()
+			if err != nil {
+				return err
+			}
+			var rules [][]string
+			for _, line := range a.layout.scanLines(result) {
+				rule, err := line.rule(a.layout)
+				if err != nil {
+					return err
+				}
+				// The domain matched src, so it is within the rule, which has no trailing empty values.
+				rule[field.index] = dst
+				rules = append(rules, rule)
+			}
+			if _, err = a.AddPoliciesIgnoreExistingCtx(ctx, field.sec, field.ptype, rules); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListDomains returns the sorted domains of the stored rules.
+func (a *Adapter) ListDomains(ctx context.Context, model model.Model) ([]string, error) {
+	fields, err := domainFields(model)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.prepare(ctx); err != nil {
+		return nil, err
+	}
+	var domains []string
+	seen := make(map[string]struct{})
+	columns := a.layout.ruleColumns()
+	for _, field := range fields {
+		if field.index+1 >= len(columns) {
+			return nil, fmt.Errorf("%w: no column for the domain of %s", ErrInvalidFilter, field.ptype)
+		}
+		column := columns[field.index+1]
+		values, err := a.reader(ctx).Where(columns[0], field.ptype).Distinct().Array(column)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if _, ok := seen[value.String()]; ok || value.String() == "" {
+				continue
+			}
+			seen[value.String()] = struct{}{}
+			domains = append(domains, value.String())
+		}
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
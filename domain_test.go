@@ -0,0 +1,62 @@
+package gdbadapter
+
+import (
+	"context"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDomainFields(t *testing.T) {
+	m, err := model.NewModelFromFile("examples/rbac_with_domains_model.conf")
+	assert.Nil(t, err)
+	fields, err := domainFields(m)
+	assert.Nil(t, err)
+	assert.Equal(t, []domainField{{sec: "g", ptype: "g", index: 2}, {sec: "p", ptype: "p", index: 1}}, fields)
+	assert.Equal(t, Filter{PType: []string{"p"}, V1: []string{"domain1"}}, fields[1].filter([]string{"domain1"}))
+
+	m, err = model.NewModelFromFile("examples/rbac_model.conf")
+	assert.Nil(t, err)
+	_, err = domainFields(m)
+	assert.NotNil(t, err)
+}
+
+func TestDomains(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapter(ctx, gdb.DefaultGroupName)
+	assert.Nil(t, err)
+	_ = a.truncateTable()
+	e, err := casbin.NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	assert.Nil(t, err)
+	assert.Nil(t, a.SavePolicy(e.GetModel()))
+	m := e.GetModel()
+
+	domains, err := a.ListDomains(ctx, m)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"domain1", "domain2"}, domains)
+
+	// The copied rules are passed to the write hooks as the enforcer would store them.
+	var copied [][]string
+	a.addWriteHook(func(ctx context.Context, tx gdb.TX, change *policyChange) error {
+		copied = append(copied, change.rules...)
+		return nil
+	})
+	assert.Nil(t, a.CopyDomain(ctx, m, "domain1", "domain3"))
+	assert.Equal(t, [][]string{{"alice", "admin", "domain3"}, {"admin", "domain3", "data1", "read"}, {"admin", "domain3", "data1", "write"}}, copied)
+	e, err = casbin.NewEnforcer("examples/rbac_with_domains_model.conf", a)
+	assert.Nil(t, err)
+	e.ClearPolicy()
+	assert.Nil(t, a.LoadDomainPolicy(ctx, e.GetModel(), "domain3"))
+	testGetPolicy(t, e, [][]string{{"admin", "domain3", "data1", "read"}, {"admin", "domain3", "data1", "write"}})
+	groupingPolicy, err := e.GetGroupingPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"alice", "admin", "domain3"}}, groupingPolicy)
+
+	assert.Nil(t, a.RemoveDomain(ctx, m, "domain1"))
+	domains, err = a.ListDomains(ctx, m)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"domain2", "domain3"}, domains)
+	_ = a.truncateTable()
+}
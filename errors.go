@@ -0,0 +1,41 @@
+package gdbadapter
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidFilter is returned when a filter of an unsupported type is given to LoadFilteredPolicy,
+	// or when a filter selects a field without column.
+	ErrInvalidFilter = errors.New("invalid filter type")
+	// ErrPolicyNotFound is returned when a rule to update does not exist in the store.
+	ErrPolicyNotFound = errors.New("policy not found")
+	// ErrDuplicatePolicy is returned when a rule to write already exists in the store.
+	ErrDuplicatePolicy = errors.New("duplicate policy")
+	// ErrValueTooLong is returned when a rule value does not fit in its column, see ValueTooLongError.
+	ErrValueTooLong = errors.New("value too long")
+	// ErrTooManyFields is returned when a rule has more than eight values and the overflow column is disabled.
+	ErrTooManyFields = errors.New("too many rule fields")
+	// ErrTransaction is returned when a transaction cannot be started, committed or rolled back.
+	ErrTransaction = errors.New("transaction failed")
+	// ErrNoTenant is returned when the tenant extractor finds no tenant in the context of an operation, see WithTenant.
+	ErrNoTenant = errors.New("no tenant in context")
+)
+
+// ValueTooLongError reports a rule value that does not fit in its column.
+// It matches ErrValueTooLong with errors.Is.
+type ValueTooLongError struct {
+	Column string
+	Size   int
+	Value  string
+}
+
+func (e *ValueTooLongError) Error() string {
+	return fmt.Sprintf("%s: column %s holds at most %d characters, got %q", ErrValueTooLong, e.Column, e.Size, e.Value)
+}
+
+// Is reports whether target is ErrValueTooLong.
+func (e *ValueTooLongError) Is(target error) bool {
+	return target == ErrValueTooLong
+}
@@ -0,0 +1,37 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCheckLine(t *testing.T) {
+	assert.Nil(t, ruleLayout{}.checkLine(CasbinRule{PType: "p", V0: "alice", V6: strings.Repeat("é", 25)}))
+
+	err := ruleLayout{}.checkLine(CasbinRule{PType: "p", V0: "alice", V6: strings.Repeat("x", 26)})
+	assert.True(t, errors.Is(err, ErrValueTooLong))
+	var tooLong *ValueTooLongError
+	assert.True(t, errors.As(err, &tooLong))
+	assert.Equal(t, "v6", tooLong.Column)
+	assert.Equal(t, 25, tooLong.Size)
+}
+
+func TestOverflowLine(t *testing.T) {
+	rule := []string{"alice", "data1", "read", "1", "2", "3", "4", "5", "6", "7", ""}
+	a := &Adapter{layout: ruleLayout{overflow: true, hash: true}}
+	line := a.savePolicyLine(context.Background(), "p", rule)
+	assert.Equal(t, `["6","7"]`, line.VExtra)
+	assert.Equal(t, []string{"p", "alice", "data1", "read", "1", "2", "3", "4", "5", "6", "7"}, line.toStringPolicy())
+	assert.Len(t, line.RuleHash, 64)
+	assert.Nil(t, a.layout.checkLine(line))
+
+	// The hash ignores trailing empty values.
+	assert.Equal(t, line.RuleHash, a.savePolicyLine(context.Background(), "p", rule[:10]).RuleHash)
+	assert.NotEqual(t, line.RuleHash, a.savePolicyLine(context.Background(), "p", rule[:9]).RuleHash)
+
+	err := ruleLayout{}.checkLine(line)
+	assert.True(t, errors.Is(err, ErrTooManyFields))
+}
@@ -0,0 +1,179 @@
+package gdbadapter
+
+import (
+	"fmt"
+	"github.com/gogf/gf/v2/database/gdb"
+	"strings"
+)
+
+// Filter selects the rules whose columns hold one of the given values, for every non-empty field,
+// and which satisfy all of its conditions.
+type Filter struct {
+	PType []string
+	V0    []string
+	V1    []string
+	V2    []string
+	V3    []string
+	V4    []string
+	V5    []string
+	V6    []string
+	V7    []string
+	// Conditions adds pattern and negation conditions on the columns.
+	Conditions []Condition
+}
+
+// Field identifies a rule column in a Condition.
+type Field int
+
+const (
+	FieldPType Field = iota
+	FieldV0
+	FieldV1
+	FieldV2
+	FieldV3
+	FieldV4
+	FieldV5
+	FieldV6
+	FieldV7
+)
+
+// Match is the operator of a Condition.
+type Match string
+
+const (
+	// MatchPrefix selects the values starting with one of the condition values.
+	MatchPrefix Match = "prefix"
+	// MatchLike selects the values matching one of the condition values as LIKE patterns.
+	MatchLike Match = "like"
+	// MatchNotIn selects the values other than the condition values.
+	MatchNotIn Match = "not_in"
+	// MatchEmpty selects the empty values.
+	MatchEmpty Match = "empty"
+	// MatchNotEmpty selects the non-empty values.
+	MatchNotEmpty Match = "not_empty"
+)
+
+// Condition restricts a column of the rules selected by a Filter, e.g.
+// Condition{Field: FieldV1, Match: MatchPrefix, Values: []string{"tenant1/"}}.
+type Condition struct {
+	Field  Field
+	Match  Match
+	Values []string
+}
+
+// likeEscaper escapes the LIKE wildcards, and the brackets of SQL Server, with '!'.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![")
+
+// BatchFilter selects the rules matching any of its filters, loaded in a single query.
+type BatchFilter struct {
+	Filters []Filter
+}
+
+// filterList returns the filters ORed by filter, a Filter, a BatchFilter or a pointer to either.
+func filterList(filter interface{}) ([]Filter, error) {
+	switch f := filter.(type) {
+	case Filter:
+		return []Filter{f}, nil
+	case *Filter:
+		if f != nil {
+			return []Filter{*f}, nil
+		}
+	case BatchFilter:
+		if len(f.Filters) > 0 {
+			return f.Filters, nil
+		}
+	case *BatchFilter:
+		if f != nil && len(f.Filters) > 0 {
+			return f.Filters, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %T", ErrInvalidFilter, filter)
+}
+
+// fields returns the values of the filter by rule column.
+func (f Filter) fields() [][]string {
+	return [][]string{f.PType, f.V0, f.V1, f.V2, f.V3, f.V4, f.V5, f.V6, f.V7}
+}
+
+// filterWhere returns the condition selecting the rules of filter, nil if it selects every rule.
+func (l ruleLayout) filterWhere(db *gdb.Model, filter Filter) (*gdb.WhereBuilder, error) {
+	columns := l.ruleColumns()
+	var where *gdb.WhereBuilder
+	for i, values := range filter.fields() {
+		if len(values) == 0 {
+			continue
+		}
+		if i >= len(columns) {
+			return nil, fmt.Errorf("%w: no column for V%d", ErrInvalidFilter, i-1)
+		}
+		if where == nil {
+			where = db.Builder()
+		}
+		where = where.WhereIn(columns[i], values)
+	}
+	for _, condition := range filter.Conditions {
+		if condition.Field < FieldPType || int(condition.Field) >= len(columns) {
+			return nil, fmt.Errorf("%w: no column for field %d", ErrInvalidFilter, condition.Field)
+		}
+		builder, err := conditionWhere(db, columns[condition.Field], condition)
+		if err != nil {
+			return nil, err
+		}
+		if where == nil {
+			where = db.Builder()
+		}
+		where = where.Where(builder)
+	}
+	return where, nil
+}
+
+// conditionWhere returns the condition on column selecting the rules of condition.
+func conditionWhere(db *gdb.Model, column string, condition Condition) (*gdb.WhereBuilder, error) {
+	where := db.Builder()
+	switch condition.Match {
+	case MatchPrefix, MatchLike, MatchNotIn:
+		if len(condition.Values) == 0 {
+			return nil, fmt.Errorf("%w: %s condition without values", ErrInvalidFilter, condition.Match)
+		}
+	}
+	switch condition.Match {
+	case MatchPrefix:
+		for _, value := range condition.Values {
+			where = where.WhereOr(column+" LIKE ? ESCAPE '!'", likeEscaper.Replace(value)+"%")
+		}
+	case MatchLike:
+		for _, value := range condition.Values {
+			where = where.WhereOrLike(column, value)
+		}
+	case MatchNotIn:
+		where = where.WhereNotIn(column, condition.Values)
+	case MatchEmpty:
+		where = where.Where(column, "").WhereOrNull(column)
+	case MatchNotEmpty:
+		where = where.WhereNotNull(column).WhereNot(column, "")
+	default:
+		return nil, fmt.Errorf("%w: unknown match %q", ErrInvalidFilter, condition.Match)
+	}
+	return where, nil
+}
+
+// filtersWhere returns the condition ORing the filters, nil if one of them selects every rule.
+func (l ruleLayout) filtersWhere(db *gdb.Model, filters []Filter) (*gdb.WhereBuilder, error) {
+	where := db.Builder()
+	all := false
+	for _, filter := range filters {
+		builder, err := l.filterWhere(db, filter)
+		if err != nil {
+			return nil, err
+		}
+		if builder == nil {
+			all = true
+			continue
+		}
+		where = where.WhereOr(builder)
+	}
+	if all {
+		return nil, nil
+	}
+	return where, nil
+}
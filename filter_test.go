@@ -0,0 +1,41 @@
+package gdbadapter
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilterList(t *testing.T) {
+	filter := Filter{PType: []string{"p"}}
+	for _, f := range []interface{}{filter, &filter} {
+		filters, err := filterList(f)
+		assert.Nil(t, err)
+		assert.Equal(t, []Filter{filter}, filters)
+	}
+	batch := BatchFilter{Filters: []Filter{filter, {PType: []string{"g"}}}}
+	for _, f := range []interface{}{batch, &batch} {
+		filters, err := filterList(f)
+		assert.Nil(t, err)
+		assert.Equal(t, batch.Filters, filters)
+	}
+	for _, f := range []interface{}{nil, (*Filter)(nil), BatchFilter{}, "p"} {
+		_, err := filterList(f)
+		assert.True(t, errors.Is(err, ErrInvalidFilter))
+	}
+}
+
+func TestLikeEscaper(t *testing.T) {
+	assert.Equal(t, "tenant!_1/", likeEscaper.Replace("tenant_1/"))
+	assert.Equal(t, "100!%!!![a]", likeEscaper.Replace("100%![a]"))
+}
+
+func TestCheckFieldValues(t *testing.T) {
+	assert.Nil(t, ruleLayout{}.checkFieldValues(6, []string{"a", "b"}))
+	assert.Nil(t, ruleLayout{}.checkFieldValues(7, []string{"a", ""}))
+	assert.True(t, errors.Is(ruleLayout{}.checkFieldValues(8, []string{"a"}), ErrInvalidFilter))
+	assert.True(t, errors.Is(ruleLayout{}.checkFieldValues(7, []string{"a", "b"}), ErrInvalidFilter))
+	mapped := ruleLayout{mapping: GormAdapterColumnMapping}
+	assert.Nil(t, mapped.checkFieldValues(0, []string{"a", "b", "c", "d", "e", "f"}))
+	assert.True(t, errors.Is(mapped.checkFieldValues(6, []string{"a"}), ErrInvalidFilter))
+}
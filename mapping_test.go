@@ -0,0 +1,41 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"github.com/gogf/gf/v2/container/gvar"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestColumnMapping(t *testing.T) {
+	a := &Adapter{layout: ruleLayout{mapping: GormAdapterColumnMapping}}
+	line := a.savePolicyLine(context.Background(), "p", []string{"alice", "data1", "read"})
+	query, args := line.queryString(a.layout)
+	assert.Equal(t, "ptype = ? and v0 = ? and v1 = ? and v2 = ?", query)
+	assert.Equal(t, []interface{}{"p", "alice", "data1", "read"}, args)
+	assert.Equal(t, gdb.Map{"ptype": "p", "v0": "alice", "v1": "data1", "v2": "read", "v3": "", "v4": "", "v5": ""}, line.data(a.layout))
+
+	// Values beyond v5 cannot be stored without the overflow column.
+	line = a.savePolicyLine(context.Background(), "p", []string{"alice", "data1", "read", "3", "4", "5", "6"})
+	assert.True(t, errors.Is(a.layout.checkLine(line), ErrTooManyFields))
+	// Nor can they be matched by a removal.
+	_, err := a.lineCondition(line)
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+	condition, err := a.lineCondition(CasbinRule{PType: "p", V1: "data1"})
+	assert.Nil(t, err)
+	assert.Equal(t, gdb.Map{"ptype": "p", "v1": "data1"}, condition)
+
+	lines := a.layout.scanLines(gdb.Result{{"id": gvar.New(7), "ptype": gvar.New("g"), "v0": gvar.New("alice"), "v1": gvar.New("admin")}})
+	assert.Equal(t, []CasbinRule{{ID: 7, PType: "g", V0: "alice", V1: "admin"}}, lines)
+
+	// With the overflow column, the values beyond v5 follow the mapped columns directly.
+	a.layout.overflow, a.layout.hash = true, true
+	rule := []string{"a", "b", "c", "d", "e", "f", "g"}
+	line = a.savePolicyLine(context.Background(), "p", rule)
+	assert.Equal(t, `["g"]`, line.VExtra)
+	loaded, err := line.rule(a.layout)
+	assert.Nil(t, err)
+	assert.Equal(t, rule, loaded)
+}
@@ -0,0 +1,330 @@
+package gdbadapter
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/frame/g"
+	"time"
+)
+
+const schemaVersionTableSuffix = "_schema_version"
+
+// migration is a step upgrading the policy table. Every step must be idempotent,
+// as concurrent instances may run it at the same time and DDL is not transactional on every database.
+type migration struct {
+	version     int
+	description string
+	// applies reports whether the step applies to the layout, nil meaning always.
+	// A step skipped for the layout is not recorded, so it runs once the layout enables it.
+	applies func(layout ruleLayout) bool
+	up      func(ctx context.Context, a *Adapter) error
+}
+
+// migrations lists the steps in the order they are applied.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create the policy table",
+		up: func(ctx context.Context, a *Adapter) error {
+			return a.createTable(ctx)
+		},
+	},
+	{
+		version:     2,
+		description: "add the created_at and updated_at columns",
+		up: func(ctx context.Context, a *Adapter) error {
+			for _, name := range []string{"created_at", "updated_at"} {
+				column := columnDef{name: name, typ: columnTimestamp, defaultValue: "CURRENT_TIMESTAMP"}
+				if err := a.addColumn(ctx, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     3,
+		description: "add the lookup index on p_type and v0",
+		applies: func(layout ruleLayout) bool {
+			return !layout.text
+		},
+		up: func(ctx context.Context, a *Adapter) error {
+			return a.createIndex(ctx, lookupIndex(a.tableName, a.layout))
+		},
+	},
+	{
+		version:     4,
+		description: "move the unique key to the rule_hash column",
+		applies: func(layout ruleLayout) bool {
+			return layout.hash
+		},
+		up: migrateRuleHash,
+	},
+	{
+		version:     5,
+		description: "widen v6 and v7",
+		applies: func(layout ruleLayout) bool {
+			return layout.hash && !layout.text
+		},
+		up: func(ctx context.Context, a *Adapter) error {
+			// Only the columns of V6 and V7 are shorter.
+			columns := a.layout.ruleColumns()
+			if len(columns) <= 7 {
+				return nil
+			}
+			return a.alterRuleColumns(ctx, columns[7:]...)
+		},
+	},
+	{
+		version:     6,
+		description: "convert the rule columns to TEXT",
+		applies: func(layout ruleLayout) bool {
+			return layout.text
+		},
+		up: func(ctx context.Context, a *Adapter) error {
+			// Neither MySQL nor SQL Server can index TEXT columns.
+			if err := a.dropIndex(ctx, lookupIndex(a.tableName, a.layout).name); err != nil {
+				return err
+			}
+			return a.alterRuleColumns(ctx, a.layout.ruleColumns()...)
+		},
+	},
+	{
+		version:     7,
+		description: "add the tenant_id column to the rows and the unique key",
+		applies: func(layout ruleLayout) bool {
+			return layout.tenant
+		},
+		up: func(ctx context.Context, a *Adapter) error {
+			if err := a.addColumn(ctx, tenantColumnDef); err != nil {
+				return err
+			}
+			if err := a.dropIndex(ctx, hashIndex(a.tableName, a.layout).name); err != nil {
+				return err
+			}
+			return a.createIndex(ctx, a.layout.uniqueIndex(a.tableName))
+		},
+	},
+	{
+		version:     8,
+		description: "add the v_extra column",
+		applies: func(layout ruleLayout) bool {
+			return layout.overflow
+		},
+		up: func(ctx context.Context, a *Adapter) error {
+			return a.addColumn(ctx, columnDef{name: "v_extra", typ: columnText})
+		},
+	},
+	{
+		version:     9,
+		description: "make rule_hash NOT NULL",
+		applies: func(layout ruleLayout) bool {
+			return layout.hash
+		},
+		up: func(ctx context.Context, a *Adapter) error {
+			// Rows written by older instances while version 4 was applied may lack their hash.
+			if err := backfillRuleHash(ctx, a); err != nil {
+				return err
+			}
+			// SQL Server cannot alter an indexed column.
+			index := a.layout.uniqueIndex(a.tableName)
+			if err := a.dropIndex(ctx, index.name); err != nil {
+				return err
+			}
+			if err := a.alterRuleColumns(ctx, "rule_hash"); err != nil {
+				return err
+			}
+			return a.createIndex(ctx, index)
+		},
+	},
+}
+
+// lookupIndex returns the index on the type and V0 columns speeding up the filtered queries of the policy table.
+func lookupIndex(tableName string, layout ruleLayout) indexDef {
+	return indexDef{name: indexName(tableName, "p_type_v0"), columns: layout.ruleColumns()[:2]}
+}
+
+// hashIndex returns the unique key over rule_hash alone, which version 7 replaces with the one covering the tenant.
+func hashIndex(tableName string, layout ruleLayout) indexDef {
+	layout.tenant = false
+	return layout.uniqueIndex(tableName)
+}
+
+// migrateRuleHash adds the rule_hash column, computes it for the stored rows
+// and replaces the unique key over the rule columns with one over rule_hash.
+func migrateRuleHash(ctx context.Context, a *Adapter) error {
+	// The column is nullable until version 9, as the stored rows have no hash yet.
+	if err := a.addColumn(ctx, columnDef{name: "rule_hash", typ: columnVarchar, size: 64}); err != nil {
+		return err
+	}
+	if err := backfillRuleHash(ctx, a); err != nil {
+		return err
+	}
+	legacy := ruleLayout{mapping: a.layout.mapping}
+	if err := a.dropIndex(ctx, legacy.uniqueIndex(a.tableName).name); err != nil {
+		return err
+	}
+	return a.createIndex(ctx, hashIndex(a.tableName, a.layout))
+}
+
+// backfillRuleHash computes the hash of the stored rows without one.
+func backfillRuleHash(ctx context.Context, a *Adapter) error {
+	// The rows are selected without the hash, which must not be part of their condition.
+	// Nor is v_extra, which is added by version 8 and only written along with the hash.
+	legacy := ruleLayout{mapping: a.layout.mapping}
+	for {
+		rows, err := a.db.Model(a.tableName).Master().Ctx(ctx).Where("rule_hash IS NULL OR rule_hash = ''").Limit(a.pageSize).All()
+		if err != nil {
+			return err
+		}
+		lines := legacy.scanLines(rows)
+		for _, line := range lines {
+			var where interface{} = line.data(legacy)
+			if id := legacy.idColumn(); id != "" {
+				where = g.Map{id: line.ID}
+			}
+			if _, err = a.db.Model(a.tableName).Ctx(ctx).Where(where).Data(g.Map{"rule_hash": line.hash()}).Update(); err != nil {
+				return err
+			}
+		}
+		if len(lines) < a.pageSize {
+			return nil
+		}
+	}
+}
+
+// Migrate applies the pending migrations to the policy table, recording them in the <table>_schema_version table.
+// It creates the table if needed, so it can replace the automatic creation, see WithMigrate.
+func (a *Adapter) Migrate(ctx context.Context) error {
+	versionTable := a.tableName + schemaVersionTableSuffix
+	if err := a.createTableDef(ctx, schemaVersionTable(versionTable)); err != nil {
+		return err
+	}
+	applied, err := a.db.Model(versionTable).Master().Ctx(ctx).Array("version")
+	if err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(applied))
+	for _, version := range applied {
+		done[version.Int()] = true
+	}
+	for _, m := range migrations {
+		if done[m.version] || (m.applies != nil && !m.applies(a.layout)) {
+			continue
+		}
+		err := m.up(ctx, a)
+		// The cached fields of the table must reflect the new columns, as gf filters the written data with them.
+		if clearErr := a.db.GetCore().ClearTableFields(ctx, a.tableName); err == nil {
+			err = clearErr
+		}
+		if err != nil {
+			return fmt.Errorf("migration %d, %s: %w", m.version, m.description, err)
+		}
+		_, err = a.db.Model(versionTable).Ctx(ctx).Data(g.Map{
+			"version":     m.version,
+			"description": m.description,
+			"applied_at":  time.Now(),
+		}).Insert()
+		// Another instance may have applied the same step concurrently.
+		if err != nil && !a.dialect.isDuplicateError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest migration version applied to the policy table, 0 if none.
+func (a *Adapter) SchemaVersion(ctx context.Context) (int, error) {
+	versionTable := a.tableName + schemaVersionTableSuffix
+	if exists, err := a.hasTable(ctx, versionTable); err != nil || !exists {
+		return 0, err
+	}
+	version, err := a.route(a.db.Model(versionTable).Ctx(ctx)).Max("version")
+	if err != nil {
+		return 0, err
+	}
+	return int(version), nil
+}
+
+// addColumn adds the column to the policy table unless it exists.
+func (a *Adapter) addColumn(ctx context.Context, column columnDef) error {
+	return a.addTableColumn(ctx, a.tableName, column)
+}
+
+// addTableColumn adds the column to the table unless it exists.
+func (a *Adapter) addTableColumn(ctx context.Context, tableName string, column columnDef) error {
+	query, args := a.dialect.hasColumnSQL(tableName, column.name)
+	count, err := a.countMaster(ctx, query, args...)
+	if err != nil || count > 0 {
+		return err
+	}
+	if _, err = a.db.Exec(ctx, a.dialect.addColumnSQL(tableName, column)); err != nil {
+		return err
+	}
+	return a.db.GetCore().ClearTableFields(ctx, tableName)
+}
+
+// alterRuleColumns changes the type of the columns of the policy table to the one of the layout.
+func (a *Adapter) alterRuleColumns(ctx context.Context, columns ...string) error {
+	for _, column := range ruleTable(a.tableName, a.layout).columns {
+		if !containsString(columns, column.name) {
+			continue
+		}
+		if statement := a.dialect.alterColumnSQL(a.tableName, column); statement != "" {
+			if _, err := a.db.Exec(ctx, statement); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasIndex reports whether the policy table has an index with the given name.
+func (a *Adapter) hasIndex(ctx context.Context, name string) (bool, error) {
+	query, args := a.dialect.hasIndexSQL(a.tableName, name)
+	count, err := a.countMaster(ctx, query, args...)
+	return count > 0, err
+}
+
+// countMaster runs the counting query on the master, as a slave may lag behind the changes of the migrations.
+func (a *Adapter) countMaster(ctx context.Context, query string, args ...interface{}) (int, error) {
+	core := a.db.GetCore()
+	link, err := core.MasterLink()
+	if err != nil {
+		return 0, err
+	}
+	result, err := core.DoSelect(ctx, link, query, args...)
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result.Array()[0].Int(), nil
+}
+
+// createIndex creates the index on the policy table unless it exists.
+func (a *Adapter) createIndex(ctx context.Context, index indexDef) error {
+	exists, err := a.hasIndex(ctx, index.name)
+	if err != nil || exists {
+		return err
+	}
+	_, err = a.db.Exec(ctx, createIndexStatement(a.dialect, a.tableName, index))
+	return err
+}
+
+// dropIndex drops the index of the policy table if it exists.
+func (a *Adapter) dropIndex(ctx context.Context, name string) error {
+	exists, err := a.hasIndex(ctx, name)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = a.db.Exec(ctx, a.dialect.dropIndexSQL(a.tableName, name))
+	return err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
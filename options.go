@@ -0,0 +1,191 @@
+package gdbadapter
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/database/gdb"
+	"time"
+)
+
+// ColumnMapping names the columns of the policy table.
+type ColumnMapping struct {
+	// ID is the auto-increment primary key column, "" if the table has none.
+	ID string
+	// PType is the column of the policy type.
+	PType string
+	// Values are the columns of the rule values V0, V1, ... in order, at most eight.
+	Values []string
+}
+
+var (
+	// DefaultColumnMapping is the layout of the tables created by this adapter.
+	DefaultColumnMapping = ColumnMapping{ID: "id", PType: "p_type", Values: []string{"v0", "v1", "v2", "v3", "v4", "v5", "v6", "v7"}}
+	// GormAdapterColumnMapping is the layout of the tables of gorm-adapter.
+	GormAdapterColumnMapping = ColumnMapping{ID: "id", PType: "ptype", Values: []string{"v0", "v1", "v2", "v3", "v4", "v5"}}
+	// XormAdapterColumnMapping is the layout of the tables of xorm-adapter, which have no primary key.
+	XormAdapterColumnMapping = ColumnMapping{PType: "p_type", Values: []string{"v0", "v1", "v2", "v3", "v4", "v5"}}
+)
+
+// Option configures an Adapter created by NewAdapterWithOptions.
+type Option func(a *Adapter)
+
+// WithGroupName sets the gf database group used to resolve the DB via g.DB.
+// It is ignored when WithDB is also given.
+func WithGroupName(groupName string) Option {
+	return func(a *Adapter) {
+		a.dbGroupName = groupName
+	}
+}
+
+// WithDB makes the adapter use an existing gdb.DB instance instead of
+// resolving one from the group configuration.
+func WithDB(db gdb.DB) Option {
+	return func(a *Adapter) {
+		a.db = db
+	}
+}
+
+// WithTableName sets the table name, without prefix, used to store policy rules.
+func WithTableName(tableName string) Option {
+	return func(a *Adapter) {
+		a.tableName = tableName
+	}
+}
+
+// WithPrefix overrides the table prefix configured on the DB.
+// An empty prefix disables prefixing entirely.
+func WithPrefix(prefix string) Option {
+	return func(a *Adapter) {
+		a.prefix = &prefix
+	}
+}
+
+// WithAutoCreateTable controls whether the policy table is created when the adapter is opened.
+// It is enabled by default.
+func WithAutoCreateTable(enable bool) Option {
+	return func(a *Adapter) {
+		a.autoCreateTable = enable
+	}
+}
+
+// WithMigrate makes NewAdapterWithOptions apply the pending schema migrations instead of only creating the table,
+// see Adapter.Migrate.
+func WithMigrate(enable bool) Option {
+	return func(a *Adapter) {
+		a.migrate = enable
+	}
+}
+
+// WithDiffSave makes SavePolicy write only the rows that differ from the stored policy,
+// see SavePolicyDiff.
+func WithDiffSave(enable bool) Option {
+	return func(a *Adapter) {
+		a.diffSave = enable
+	}
+}
+
+// WithFilteredSave makes SavePolicy of an adapter whose policy was loaded by LoadFilteredPolicy
+// replace only the rows matching the loaded filters in a single transaction, leaving the other rows untouched.
+// IsFiltered then reports false, so casbin's Enforcer.SavePolicy accepts the filtered policy.
+func WithFilteredSave(enable bool) Option {
+	return func(a *Adapter) {
+		a.filteredSave = enable
+	}
+}
+
+// WithIgnoreExisting makes AddPolicy and AddPolicies skip the rules already stored instead of failing,
+// see AddPoliciesIgnoreExisting.
+func WithIgnoreExisting(enable bool) Option {
+	return func(a *Adapter) {
+		a.ignoreExisting = enable
+	}
+}
+
+// WithOverflowColumn stores the values of rules beyond V7 as a JSON array in a v_extra column,
+// so rules of any length can be saved. The unique key then covers the whole rule through a rule_hash column.
+// Without it, rules with more than eight values are rejected with ErrTooManyFields.
+func WithOverflowColumn(enable bool) Option {
+	return func(a *Adapter) {
+		a.layout.overflow = enable
+		if enable {
+			a.layout.hash = true
+		}
+	}
+}
+
+// WithRuleHash stores the SHA-256 of every rule in a rule_hash column carrying the unique key
+// instead of the rule columns, which lifts the index length limit on the column widths.
+func WithRuleHash(enable bool) Option {
+	return func(a *Adapter) {
+		a.layout.hash = enable
+	}
+}
+
+// WithTextColumns declares the rule columns as TEXT so values of any length can be stored.
+// It implies WithRuleHash, as TEXT columns cannot be part of the unique key.
+func WithTextColumns(enable bool) Option {
+	return func(a *Adapter) {
+		a.layout.text = enable
+		if enable {
+			a.layout.hash = true
+		}
+	}
+}
+
+// TenantFunc returns the tenant of the operations made with ctx, "" if there is none.
+type TenantFunc func(ctx context.Context) string
+
+// WithTenant restricts every query of the adapter to the rows whose tenant_id column holds the tenant
+// extracted from the context, and stores that tenant in the added rows.
+// SavePolicy then replaces the rules of the tenant only. Operations whose context has no tenant fail with ErrNoTenant,
+// and the methods without a context use the one of NewAdapterWithOptions.
+// It enables the rule hash, the unique key of the table covering the tenant and the hash.
+func WithTenant(tenantFunc TenantFunc) Option {
+	return func(a *Adapter) {
+		a.tenantFunc = tenantFunc
+		a.layout.tenant = tenantFunc != nil
+		if tenantFunc != nil {
+			a.layout.hash = true
+		}
+	}
+}
+
+// WithColumnMapping sets the names of the columns of the policy table,
+// e.g. GormAdapterColumnMapping to share the table of a service using gorm-adapter.
+// Rules with more values than value columns are rejected unless WithOverflowColumn is given.
+// Without an ID column, LoadPolicy reads the table in a single query.
+func WithColumnMapping(mapping ColumnMapping) Option {
+	return func(a *Adapter) {
+		a.layout.mapping = ColumnMapping{ID: mapping.ID, PType: mapping.PType, Values: append([]string{}, mapping.Values...)}
+	}
+}
+
+// WithPageSize sets the number of rows loaded per query by LoadPolicy and LoadFilteredPolicy.
+// It defaults to 1000.
+func WithPageSize(pageSize int) Option {
+	return func(a *Adapter) {
+		a.pageSize = pageSize
+	}
+}
+
+// WithSlaveReads routes the reads of LoadPolicy, LoadFilteredPolicy, ListAuditEntries and SchemaVersion
+// to the slave nodes of the gf database group. They run on the master node otherwise, like the mutations.
+func WithSlaveReads(enable bool) Option {
+	return func(a *Adapter) {
+		a.slaveReads = enable
+	}
+}
+
+// WithReadYourWrites routes the reads made within the window following a write through the adapter
+// to the master node, so they see the write despite the replication lag of the slave nodes.
+func WithReadYourWrites(window time.Duration) Option {
+	return func(a *Adapter) {
+		a.readYourWrites = window
+	}
+}
+
+// WithLoadObserver registers a function called after every page loaded by LoadPolicy and LoadFilteredPolicy.
+func WithLoadObserver(observer func(ctx context.Context, progress LoadProgress)) Option {
+	return func(a *Adapter) {
+		a.loadObserver = observer
+	}
+}
@@ -0,0 +1,220 @@
+package gdbadapter
+
+import (
+	"strings"
+)
+
+// columnType is the dialect independent type of a column.
+type columnType int
+
+const (
+	// columnAutoID is an auto-increment primary key.
+	columnAutoID columnType = iota
+	columnInt
+	columnBigint
+	columnVarchar
+	columnText
+	columnTimestamp
+)
+
+// columnDef describes a column of a table created by the adapter.
+type columnDef struct {
+	name         string
+	typ          columnType
+	size         int
+	notNull      bool
+	primaryKey   bool
+	defaultValue string
+}
+
+// indexDef describes an index of a table created by the adapter.
+type indexDef struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+// tableDef describes a table created by the adapter.
+type tableDef struct {
+	name    string
+	columns []columnDef
+	indexes []indexDef
+}
+
+// ruleLayout describes the columns of the policy table.
+type ruleLayout struct {
+	// mapping names the columns, DefaultColumnMapping when zero.
+	mapping ColumnMapping
+	// overflow stores the values beyond v7 as a JSON array in the v_extra column.
+	overflow bool
+	// hash moves the unique key from the rule columns to the rule_hash column.
+	hash bool
+	// text declares the rule columns as TEXT, which requires hash.
+	text bool
+	// tenant adds the tenant_id column to the rows and to the unique key, which requires hash.
+	tenant bool
+}
+
+// tenantColumn is the column isolating the rules of the tenants, see WithTenant.
+const tenantColumn = "tenant_id"
+
+// names returns the column mapping of the layout.
+func (l ruleLayout) names() ColumnMapping {
+	if l.mapping.PType == "" {
+		return DefaultColumnMapping
+	}
+	return l.mapping
+}
+
+// idColumn returns the auto-increment primary key column, "" if the table has none.
+func (l ruleLayout) idColumn() string {
+	return l.names().ID
+}
+
+// ruleColumns returns the type column followed by the value columns, in the order of the unique key.
+func (l ruleLayout) ruleColumns() []string {
+	names := l.names()
+	return append([]string{names.PType}, names.Values...)
+}
+
+// columns returns the columns written for a rule, in the order of CasbinRule.args.
+func (l ruleLayout) columns() []string {
+	columns := l.ruleColumns()
+	if l.overflow {
+		columns = append(columns, "v_extra")
+	}
+	if l.hash {
+		columns = append(columns, "rule_hash")
+	}
+	if l.tenant {
+		columns = append(columns, tenantColumn)
+	}
+	return columns
+}
+
+// uniqueIndex returns the unique key of the policy table.
+func (l ruleLayout) uniqueIndex(tableName string) indexDef {
+	if l.tenant {
+		return indexDef{name: indexName(tableName, "tenant_rule_hash"), columns: []string{tenantColumn, "rule_hash"}, unique: true}
+	}
+	if l.hash {
+		return indexDef{name: indexName(tableName, "rule_hash"), columns: []string{"rule_hash"}, unique: true}
+	}
+	return indexDef{name: indexName(tableName), columns: l.ruleColumns(), unique: true}
+}
+
+// columnSize returns the VARCHAR length of the i-th rule column, or 0 for TEXT columns.
+// The columns of V6 and V7 are shorter only to keep the unique key over the rule columns
+// within the index length limit of InnoDB.
+func (l ruleLayout) columnSize(i int) int {
+	switch {
+	case l.text:
+		return 0
+	case !l.hash && i > 6:
+		return 25
+	default:
+		return 100
+	}
+}
+
+// tenantColumnDef is the definition of the tenant column, the rows stored before it was added belonging to no tenant.
+var tenantColumnDef = columnDef{name: tenantColumn, typ: columnVarchar, size: 64, notNull: true, defaultValue: "''"}
+
+// indexName returns the name of an index of the table.
+func indexName(tableName string, suffix ...string) string {
+	return strings.Join(append([]string{"idx", strings.ReplaceAll(tableName, ".", "_")}, suffix...), "_")
+}
+
+// ruleTable returns the definition of the policy table.
+func ruleTable(tableName string, layout ruleLayout) tableDef {
+	table := tableDef{name: tableName}
+	if id := layout.idColumn(); id != "" {
+		table.columns = append(table.columns, columnDef{name: id, typ: columnAutoID})
+	}
+	for i, column := range layout.ruleColumns() {
+		if size := layout.columnSize(i); size > 0 {
+			table.columns = append(table.columns, columnDef{name: column, typ: columnVarchar, size: size})
+		} else {
+			table.columns = append(table.columns, columnDef{name: column, typ: columnText})
+		}
+	}
+	if layout.overflow {
+		table.columns = append(table.columns, columnDef{name: "v_extra", typ: columnText})
+	}
+	if layout.hash {
+		table.columns = append(table.columns, columnDef{name: "rule_hash", typ: columnVarchar, size: 64, notNull: true})
+	}
+	if layout.tenant {
+		table.columns = append(table.columns, tenantColumnDef)
+	}
+	table.indexes = []indexDef{layout.uniqueIndex(tableName)}
+	return table
+}
+
+// revisionTable returns the definition of the table holding the policy revision polled by Watcher.
+func revisionTable(tableName string) tableDef {
+	return tableDef{
+		name: tableName,
+		columns: []columnDef{
+			{name: "id", typ: columnInt, notNull: true, primaryKey: true},
+			{name: "revision", typ: columnBigint, notNull: true, defaultValue: "0"},
+			{name: "updated_by", typ: columnVarchar, size: 64},
+		},
+	}
+}
+
+// schemaVersionTable returns the definition of the table recording the migrations applied to the policy table.
+func schemaVersionTable(tableName string) tableDef {
+	return tableDef{
+		name: tableName,
+		columns: []columnDef{
+			{name: "version", typ: columnInt, notNull: true, primaryKey: true},
+			{name: "description", typ: columnVarchar, size: 255},
+			{name: "applied_at", typ: columnTimestamp},
+		},
+	}
+}
+
+// logTable returns the definition of the change-log table tailed by LogWatcher.
+func logTable(tableName string) tableDef {
+	return tableDef{
+		name: tableName,
+		columns: []columnDef{
+			{name: "seq", typ: columnBigint, notNull: true, primaryKey: true},
+			{name: "op", typ: columnVarchar, size: 32, notNull: true},
+			{name: "sec", typ: columnVarchar, size: 16},
+			{name: "p_type", typ: columnVarchar, size: 100},
+			{name: "rules", typ: columnText},
+			{name: "old_rules", typ: columnText},
+			{name: "field_index", typ: columnInt},
+			{name: "field_values", typ: columnText},
+			{name: "created_by", typ: columnVarchar, size: 64},
+			{name: "created_at", typ: columnTimestamp},
+			tenantColumnDef,
+		},
+		indexes: []indexDef{{name: indexName(tableName, "created_at"), columns: []string{"created_at"}}},
+	}
+}
+
+// auditTable returns the definition of the audit table.
+func auditTable(tableName string) tableDef {
+	return tableDef{
+		name: tableName,
+		columns: []columnDef{
+			{name: "id", typ: columnAutoID},
+			{name: "op", typ: columnVarchar, size: 32, notNull: true},
+			{name: "sec", typ: columnVarchar, size: 16},
+			{name: "p_type", typ: columnVarchar, size: 100},
+			{name: "rule", typ: columnText},
+			{name: "old_rule", typ: columnText},
+			{name: "field_index", typ: columnInt},
+			{name: "actor", typ: columnVarchar, size: 255},
+			{name: "created_at", typ: columnTimestamp},
+			tenantColumnDef,
+		},
+		indexes: []indexDef{
+			{name: indexName(tableName, "actor"), columns: []string{"actor"}},
+			{name: indexName(tableName, "created_at"), columns: []string{"created_at"}},
+		},
+	}
+}
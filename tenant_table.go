@@ -0,0 +1,103 @@
+package gdbadapter
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gdb"
+	"sync"
+)
+
+// tableCache remembers the policy tables known to exist, see WithTablePerTenant.
+type tableCache struct {
+	mutex  sync.Mutex
+	exists map[string]bool
+}
+
+// WithTablePerTenant stores the rules of every tenant in its own policy table, named after the table name
+// followed by an underscore and the tenant extracted from the context, e.g. casbin_rule_tenant1.
+// The table of a tenant is created by its first operation unless automatic creation is disabled.
+// Tenants may only contain ASCII letters, digits and underscores, and operations whose context has no tenant
+// fail with ErrNoTenant. The methods without a context use the one of NewAdapterWithOptions,
+// and Migrate only upgrades the table named by WithTableName.
+// The tenants share the change-log and audit tables, whose rows record the tenant, see NewLogWatcher and ListAuditEntries,
+// while a Watcher reports the changes of every tenant.
+func WithTablePerTenant(tenantFunc TenantFunc) Option {
+	return func(a *Adapter) {
+		a.tableTenantFunc = tenantFunc
+	}
+}
+
+// policyTable returns the policy table of the operations made with ctx.
+func (a *Adapter) policyTable(ctx context.Context) string {
+	if a.tableTenantFunc == nil {
+		return a.tableName
+	}
+	return a.tableName + "_" + a.tableTenantFunc(ctx)
+}
+
+// prepare checks the tenant of ctx and creates its policy table if needed.
+// Every operation calls it before its first query, outside any transaction, as DDL commits implicitly on MySQL.
+func (a *Adapter) prepare(ctx context.Context) error {
+	if _, err := a.tenant(ctx); err != nil {
+		return err
+	}
+	if a.tableTenantFunc == nil {
+		return nil
+	}
+	tenant := a.tableTenantFunc(ctx)
+	if tenant == "" {
+		return ErrNoTenant
+	}
+	if !validTableTenant(tenant) {
+		return fmt.Errorf("invalid tenant %q in a table name", tenant)
+	}
+	return a.ensureTable(ctx, a.policyTable(ctx))
+}
+
+// changeTenant returns the tenant recorded with the changes made with ctx, the one of the tenant column
+// or else the one of the policy table, and ErrNoTenant if either is enabled and ctx has no tenant.
+func (a *Adapter) changeTenant(ctx context.Context) (string, error) {
+	if a.tableTenantFunc == nil || a.tenantFunc != nil {
+		return a.tenant(ctx)
+	}
+	tenant := a.tableTenantFunc(ctx)
+	if tenant == "" {
+		return "", ErrNoTenant
+	}
+	return tenant, nil
+}
+
+// ensureTable creates the policy table unless the cache or hasTable tells it exists.
+// The DDL runs outside any transaction of ctx, as it commits implicitly on MySQL.
+func (a *Adapter) ensureTable(ctx context.Context, name string) error {
+	ctx = gdb.WithoutTX(ctx, a.db.GetGroup())
+	a.tables.mutex.Lock()
+	defer a.tables.mutex.Unlock()
+	if a.tables.exists[name] {
+		return nil
+	}
+	exists, err := a.hasTable(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if !a.autoCreateTable {
+			return fmt.Errorf("policy table %s does not exist", name)
+		}
+		if err = a.createTableDef(ctx, ruleTable(name, a.layout)); err != nil {
+			return err
+		}
+	}
+	a.tables.exists[name] = true
+	return nil
+}
+
+// validTableTenant reports whether the tenant can be part of a table name without quoting issues.
+func validTableTenant(tenant string) bool {
+	for _, c := range tenant {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"github.com/casbin/casbin/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidTableTenant(t *testing.T) {
+	assert.True(t, validTableTenant("tenant_1"))
+	assert.True(t, validTableTenant("Acme42"))
+	assert.False(t, validTableTenant("tenant-1"))
+	assert.False(t, validTableTenant("t`; DROP TABLE x"))
+	assert.False(t, validTableTenant("é"))
+}
+
+func TestTablePerTenant(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_routed"), WithTablePerTenant(contextTenant), WithAudit(nil))
+	assert.Nil(t, err)
+	ctx1 := context.WithValue(ctx, tenantKey{}, "tenant1")
+	ctx2 := context.WithValue(ctx, tenantKey{}, "tenant2")
+	defer func() {
+		for _, c := range []context.Context{ctx1, ctx2} {
+			_, _ = a.db.Exec(ctx, a.dialect.dropTableSQL(a.policyTable(c)))
+		}
+		_, _ = a.db.Exec(ctx, a.dialect.dropTableSQL(a.audit.tableName))
+	}()
+
+	// The base table is not created, the table of a tenant is by its first operation.
+	exists, err := a.HasTable(a.tableName)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, a.AddPolicyCtx(ctx1, "p", "p", []string{"alice", "data1", "read"}))
+	assert.Nil(t, a.AddPolicyCtx(ctx2, "p", "p", []string{"bob", "data2", "write"}))
+	exists, err = a.HasTable(a.tableName + "_tenant1")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf")
+	assert.Nil(t, err)
+	assert.Nil(t, a.LoadPolicyCtx(ctx2, e.GetModel()))
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}})
+
+	// The tenants share the audit table, whose entries are listed by tenant.
+	entries, err := a.ListAuditEntries(ctx1, AuditQuery{})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []string{"alice", "data1", "read"}, entries[0].Rule)
+
+	assert.True(t, errors.Is(a.LoadPolicyCtx(ctx, e.GetModel()), ErrNoTenant))
+	assert.NotNil(t, a.LoadPolicyCtx(context.WithValue(ctx, tenantKey{}, "tenant-3"), e.GetModel()))
+}
@@ -0,0 +1,226 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/guid"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	revisionTableSuffix = "_revision"
+	revisionRowID       = 1
+	defaultPollInterval = 5 * time.Second
+)
+
+var _ persist.Watcher = (*Watcher)(nil)
+
+// Watcher is a persist.Watcher keeping several enforcers sharing one policy table in sync.
+// Every policy mutation made through the adapter increments a revision stored in a companion table
+// within the same transaction, and every Watcher polls that revision, invoking the update callback when it changes.
+type Watcher struct {
+	db           gdb.DB
+	tableName    string
+	instanceID   string
+	options      watcherOptions
+	mutex        sync.Mutex
+	callback     func(string)
+	lastRevision int64
+	closeOnce    sync.Once
+	closed       chan struct{}
+	done         chan struct{}
+}
+
+type watcherOptions struct {
+	interval   time.Duration
+	ignoreSelf bool
+	retention  time.Duration
+	batchSize  int
+}
+
+// WatcherOption configures a Watcher created by NewWatcher or a LogWatcher created by NewLogWatcher.
+type WatcherOption func(o *watcherOptions)
+
+// WithPollInterval sets how often the database is polled. It defaults to 5 seconds.
+func WithPollInterval(interval time.Duration) WatcherOption {
+	return func(o *watcherOptions) {
+		o.interval = interval
+	}
+}
+
+// WithIgnoreSelf skips the update callback of a Watcher for revisions made by its own adapter alone.
+func WithIgnoreSelf(ignoreSelf bool) WatcherOption {
+	return func(o *watcherOptions) {
+		o.ignoreSelf = ignoreSelf
+	}
+}
+
+// newWatcherOptions applies opts over the default options.
+func newWatcherOptions(opts []WatcherOption) (watcherOptions, error) {
+	options := watcherOptions{
+		interval:  defaultPollInterval,
+		batchSize: defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.interval <= 0 {
+		return options, errors.New("poll interval must be positive")
+	}
+	if options.batchSize <= 0 {
+		return options, errors.New("batch size must be positive")
+	}
+	return options, nil
+}
+
+// NewWatcher creates the revision table next to the policy table of the adapter if needed,
+// makes the adapter record a new revision on every mutation and starts polling.
+// It must be called before the adapter is used concurrently.
+func NewWatcher(ctx context.Context, a *Adapter, opts ...WatcherOption) (*Watcher, error) {
+	options, err := newWatcherOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		db:         a.db,
+		tableName:  a.tableName + revisionTableSuffix,
+		instanceID: guid.S(),
+		options:    options,
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if err = initRevision(ctx, a, w.tableName); err != nil {
+		return nil, err
+	}
+	revision, _, err := w.revision(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.lastRevision = revision
+	a.addWriteHook(w.bump)
+
+	go w.poll(ctx)
+	return w, nil
+}
+
+// initRevision creates the revision table of the adapter and inserts the revision row
+// unless another instance already did.
+func initRevision(ctx context.Context, a *Adapter, tableName string) error {
+	if err := a.createTableDef(ctx, revisionTable(tableName)); err != nil {
+		return err
+	}
+	count, err := a.db.Model(tableName).Ctx(ctx).Where("id", revisionRowID).Count()
+	if err != nil || count > 0 {
+		return err
+	}
+	if _, err = a.db.Model(tableName).Ctx(ctx).Data(g.Map{"id": revisionRowID, "revision": 0}).Insert(); err != nil {
+		// The row may have been inserted concurrently.
+		count, countErr := a.db.Model(tableName).Ctx(ctx).Where("id", revisionRowID).Count()
+		if countErr != nil || count == 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpRevision increments the revision within tx and returns it.
+// The row lock taken by the update serializes the concurrent mutations until they commit.
+func bumpRevision(tx gdb.TX, tableName, instanceID string) (int64, error) {
+	_, err := tx.Model(tableName).Where("id", revisionRowID).Data(g.Map{
+		"revision":   &gdb.Counter{Field: "revision", Value: 1},
+		"updated_by": instanceID,
+	}).Update()
+	if err != nil {
+		return 0, err
+	}
+	revision, err := tx.Model(tableName).Where("id", revisionRowID).Value("revision")
+	if err != nil {
+		return 0, err
+	}
+	return revision.Int64(), nil
+}
+
+// bump increments the revision within the transaction of a policy mutation.
+func (w *Watcher) bump(ctx context.Context, tx gdb.TX, change *policyChange) error {
+	_, err := bumpRevision(tx, w.tableName, w.instanceID)
+	return err
+}
+
+// revision returns the current revision and the instance that made it.
+func (w *Watcher) revision(ctx context.Context) (int64, string, error) {
+	record, err := w.db.Model(w.tableName).Ctx(ctx).Fields("revision", "updated_by").Where("id", revisionRowID).One()
+	if err != nil {
+		return 0, "", err
+	}
+	if record.IsEmpty() {
+		return 0, "", nil
+	}
+	return record["revision"].Int64(), record["updated_by"].String(), nil
+}
+
+func (w *Watcher) poll(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.check(ctx); err != nil {
+				g.Log().Errorf(ctx, "casbin watcher: poll revision of %s: %v", w.tableName, err)
+			}
+		}
+	}
+}
+
+// check invokes the update callback if the revision changed since the last check.
+func (w *Watcher) check(ctx context.Context) error {
+	revision, updatedBy, err := w.revision(ctx)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	last := w.lastRevision
+	w.lastRevision = revision
+	callback := w.callback
+	w.mutex.Unlock()
+
+	if revision == last || callback == nil {
+		return nil
+	}
+	// A single increment made by this instance carries no change from other instances.
+	if w.options.ignoreSelf && revision == last+1 && updatedBy == w.instanceID {
+		return nil
+	}
+	callback(strconv.FormatInt(revision, 10))
+	return nil
+}
+
+// SetUpdateCallback sets the callback function invoked with the new revision when the policy changed.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update does nothing, as the adapter already records a new revision within the transaction of every mutation.
+func (w *Watcher) Update() error {
+	return nil
+}
+
+// Close stops polling.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.closed)
+	})
+	<-w.done
+}
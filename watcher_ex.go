@@ -0,0 +1,420 @@
+package gdbadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/guid"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	logTableSuffix = "_log"
+	compactEvery   = time.Minute
+)
+
+var (
+	_ persist.WatcherEx        = (*LogWatcher)(nil)
+	_ persist.UpdatableWatcher = (*LogWatcher)(nil)
+)
+
+// WithLogRetention makes a LogWatcher delete the change-log entries older than retention, see LogWatcher.Compact.
+func WithLogRetention(retention time.Duration) WatcherOption {
+	return func(o *watcherOptions) {
+		o.retention = retention
+	}
+}
+
+// WithLogBatchSize sets the number of change-log entries read per query by a LogWatcher. It defaults to 1000.
+func WithLogBatchSize(batchSize int) WatcherOption {
+	return func(o *watcherOptions) {
+		o.batchSize = batchSize
+	}
+}
+
+// PolicyApplier is an enforcer the policy changes of other instances are applied to.
+// The changes go straight to its model, as the Self methods of casbin still call the adapter with auto-save enabled.
+// *casbin.Enforcer and *casbin.SyncedEnforcer implement it, the model of the latter being changed under its lock.
+type PolicyApplier interface {
+	GetModel() model.Model
+	BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error
+	LoadPolicy() error
+}
+
+// lockedApplier is implemented by *casbin.SyncedEnforcer.
+type lockedApplier interface {
+	GetLock() *sync.RWMutex
+}
+
+// logEntry is a row of the change-log table.
+type logEntry struct {
+	Seq         int64  `orm:"seq"`
+	Op          string `orm:"op"`
+	Sec         string `orm:"sec"`
+	PType       string `orm:"p_type"`
+	Rules       string `orm:"rules"`
+	OldRules    string `orm:"old_rules"`
+	FieldIndex  int    `orm:"field_index"`
+	FieldValues string `orm:"field_values"`
+	CreatedBy   string `orm:"created_by"`
+	Tenant      string `orm:"tenant_id"`
+}
+
+// LogWatcher is a persist.WatcherEx propagating policy deltas between enforcers sharing one policy table.
+// Every policy mutation made through the adapter appends an entry to a change-log table within the same transaction,
+// and every LogWatcher tails the log by sequence number, applying the entries written by other instances
+// to its enforcer, see SetEnforcer.
+//
+// The entries are numbered by the revision of Watcher, which serializes concurrent mutations,
+// so they become visible in sequence order.
+type LogWatcher struct {
+	db                gdb.DB
+	tableName         string
+	revisionTableName string
+	instanceID        string
+	tenant            string
+	options           watcherOptions
+	mutex             sync.Mutex
+	callback          func(string)
+	enforcer          PolicyApplier
+	lastSeq           int64
+	lastCompaction    time.Time
+	closeOnce         sync.Once
+	closed            chan struct{}
+	done              chan struct{}
+}
+
+// NewLogWatcher creates the change-log and revision tables next to the policy table of the adapter if needed,
+// makes the adapter log every mutation and starts tailing the log from its current end.
+// With WithTenant or WithTablePerTenant, the watcher only applies the changes of the tenant of ctx.
+// It must be called before the adapter is used concurrently.
+func NewLogWatcher(ctx context.Context, a *Adapter, opts ...WatcherOption) (*LogWatcher, error) {
+	options, err := newWatcherOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := a.changeTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w := &LogWatcher{
+		db:                a.db,
+		tableName:         a.tableName + logTableSuffix,
+		revisionTableName: a.tableName + revisionTableSuffix,
+		instanceID:        guid.S(),
+		tenant:            tenant,
+		options:           options,
+		closed:            make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+	if err = initRevision(ctx, a, w.revisionTableName); err != nil {
+		return nil, err
+	}
+	if err = a.createTableDef(ctx, logTable(w.tableName)); err != nil {
+		return nil, err
+	}
+	// Change-log tables created before the tenant column.
+	if err = a.addTableColumn(ctx, w.tableName, tenantColumnDef); err != nil {
+		return nil, err
+	}
+	lastSeq, err := w.db.Model(w.tableName).Ctx(ctx).Max("seq")
+	if err != nil {
+		return nil, err
+	}
+	w.lastSeq = int64(lastSeq)
+	a.addWriteHook(w.record)
+
+	go w.poll(ctx)
+	return w, nil
+}
+
+// record appends the change to the log within the transaction of a policy mutation.
+func (w *LogWatcher) record(ctx context.Context, tx gdb.TX, change *policyChange) error {
+	seq, err := bumpRevision(tx, w.revisionTableName, w.instanceID)
+	if err != nil {
+		return err
+	}
+	changedRules, replacedRules := change.rules, change.oldRules
+	if change.op == OpSavePolicy {
+		// Peers reload the whole policy after a save, so its rules are not logged.
+		changedRules, replacedRules = nil, nil
+	}
+	rules, err := json.Marshal(changedRules)
+	if err != nil {
+		return err
+	}
+	oldRules, err := json.Marshal(replacedRules)
+	if err != nil {
+		return err
+	}
+	fieldValues, err := json.Marshal(change.fieldValues)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model(w.tableName).Data(g.Map{
+		"seq":          seq,
+		"op":           string(change.op),
+		"sec":          change.sec,
+		"p_type":       change.ptype,
+		"rules":        string(rules),
+		"old_rules":    string(oldRules),
+		"field_index":  change.fieldIndex,
+		"field_values": string(fieldValues),
+		"created_by":   w.instanceID,
+		"created_at":   time.Now(),
+		tenantColumn:   change.tenant,
+	}).Insert()
+	return err
+}
+
+func (w *LogWatcher) poll(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.tail(ctx); err != nil {
+				g.Log().Errorf(ctx, "casbin watcher: tail change log %s: %v", w.tableName, err)
+			}
+			if w.options.retention > 0 && time.Since(w.lastCompaction) >= compactEvery {
+				if _, err := w.Compact(ctx, time.Now().Add(-w.options.retention)); err != nil {
+					g.Log().Errorf(ctx, "casbin watcher: compact change log %s: %v", w.tableName, err)
+				}
+				w.lastCompaction = time.Now()
+			}
+		}
+	}
+}
+
+// tail applies the entries appended to the log since the last call.
+func (w *LogWatcher) tail(ctx context.Context) error {
+	w.mutex.Lock()
+	enforcer, callback := w.enforcer, w.callback
+	w.mutex.Unlock()
+
+	// Entries following the last applied one have been compacted away, only a full reload can catch up.
+	minSeq, err := w.db.Model(w.tableName).Ctx(ctx).Min("seq")
+	if err != nil {
+		return err
+	}
+	maxSeq, err := w.db.Model(w.tableName).Ctx(ctx).Max("seq")
+	if err != nil {
+		return err
+	}
+	if int64(minSeq) > w.lastSeq+1 {
+		w.lastSeq = int64(maxSeq)
+		return w.reload(enforcer, callback, w.lastSeq)
+	}
+
+	// Only the entries of the tenant are read, up to the last entry of any tenant,
+	// which becomes the position of the watcher so that compacting the other tenants does not look like a gap.
+	// The entries are visible in sequence order, so none of the tenant can appear below it later.
+	changed := false
+	for {
+		var entries []logEntry
+		err = w.db.Model(w.tableName).Ctx(ctx).Where(tenantColumn, w.tenant).
+			Where("seq > ? AND seq <= ?", w.lastSeq, int64(maxSeq)).Order("seq").Limit(w.options.batchSize).Scan(&entries)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			w.lastSeq = entry.Seq
+			if entry.CreatedBy == w.instanceID {
+				continue
+			}
+			changed = true
+			if enforcer == nil {
+				continue
+			}
+			if err = w.apply(enforcer, entry); err != nil {
+				g.Log().Errorf(ctx, "casbin watcher: apply change %d: %v, reloading policy", entry.Seq, err)
+				if err = enforcer.LoadPolicy(); err != nil {
+					return err
+				}
+			}
+		}
+		if len(entries) < w.options.batchSize {
+			break
+		}
+	}
+	if int64(maxSeq) > w.lastSeq {
+		w.lastSeq = int64(maxSeq)
+	}
+	if changed && enforcer == nil && callback != nil {
+		callback(strconv.FormatInt(w.lastSeq, 10))
+	}
+	return nil
+}
+
+// apply applies the change of the entry to the model of the enforcer without calling its adapter,
+// reloading the whole policy for the changes that are not deltas.
+func (w *LogWatcher) apply(enforcer PolicyApplier, entry logEntry) error {
+	var (
+		rules, oldRules [][]string
+		fieldValues     []string
+	)
+	if err := json.Unmarshal([]byte(entry.Rules), &rules); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(entry.OldRules), &oldRules); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(entry.FieldValues), &fieldValues); err != nil {
+		return err
+	}
+
+	switch Operation(entry.Op) {
+	case OpAddPolicies, OpRemovePolicies, OpRemoveFilteredPolicy, OpUpdatePolicies, OpUpdateFilteredPolicies:
+	default:
+		return enforcer.LoadPolicy()
+	}
+	if locked, ok := enforcer.(lockedApplier); ok {
+		locked.GetLock().Lock()
+		defer locked.GetLock().Unlock()
+	}
+
+	var (
+		m              = enforcer.GetModel()
+		added, removed [][]string
+		err            error
+	)
+	switch Operation(entry.Op) {
+	case OpAddPolicies:
+		added, err = m.AddPoliciesWithAffected(entry.Sec, entry.PType, rules)
+	case OpRemovePolicies:
+		removed, err = m.RemovePoliciesWithAffected(entry.Sec, entry.PType, rules)
+	case OpRemoveFilteredPolicy:
+		if len(fieldValues) > 0 {
+			_, removed, err = m.RemoveFilteredPolicy(entry.Sec, entry.PType, entry.FieldIndex, fieldValues...)
+		}
+	case OpUpdatePolicies:
+		var updated bool
+		if updated, err = m.UpdatePolicies(entry.Sec, entry.PType, oldRules, rules); err == nil && !updated {
+			err = fmt.Errorf("%w: %v", ErrPolicyNotFound, oldRules)
+		}
+		removed, added = oldRules, rules
+	case OpUpdateFilteredPolicies:
+		if removed, err = m.RemovePoliciesWithAffected(entry.Sec, entry.PType, oldRules); err == nil {
+			added, err = m.AddPoliciesWithAffected(entry.Sec, entry.PType, rules)
+		}
+	}
+	if err != nil || entry.Sec != "g" {
+		return err
+	}
+	if len(removed) > 0 {
+		if err = enforcer.BuildIncrementalRoleLinks(model.PolicyRemove, entry.PType, removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		err = enforcer.BuildIncrementalRoleLinks(model.PolicyAdd, entry.PType, added)
+	}
+	return err
+}
+
+// reload makes the enforcer, or else the update callback, reload the whole policy.
+func (w *LogWatcher) reload(enforcer PolicyApplier, callback func(string), seq int64) error {
+	if enforcer != nil {
+		return enforcer.LoadPolicy()
+	}
+	if callback != nil {
+		callback(strconv.FormatInt(seq, 10))
+	}
+	return nil
+}
+
+// Compact deletes the log entries created before the given time, always keeping the last entry
+// so that instances lagging behind can detect that they must reload the whole policy.
+func (w *LogWatcher) Compact(ctx context.Context, before time.Time) (int64, error) {
+	maxSeq, err := w.db.Model(w.tableName).Ctx(ctx).Max("seq")
+	if err != nil {
+		return 0, err
+	}
+	result, err := w.db.Model(w.tableName).Ctx(ctx).
+		Where("created_at < ?", before).Where("seq < ?", int64(maxSeq)).Delete()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SetEnforcer sets the enforcer the changes of other instances are applied to.
+// The changes are applied from the polling goroutine, so the enforcer should be a *casbin.SyncedEnforcer.
+func (w *LogWatcher) SetEnforcer(enforcer PolicyApplier) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.enforcer = enforcer
+}
+
+// SetUpdateCallback sets the callback function invoked with the sequence number of the change
+// when no enforcer has been set with SetEnforcer.
+func (w *LogWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update does nothing, as the adapter already logs every mutation within its transaction.
+func (w *LogWatcher) Update() error {
+	return nil
+}
+
+// UpdateForAddPolicy does nothing, see Update.
+func (w *LogWatcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return nil
+}
+
+// UpdateForRemovePolicy does nothing, see Update.
+func (w *LogWatcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return nil
+}
+
+// UpdateForRemoveFilteredPolicy does nothing, see Update.
+func (w *LogWatcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return nil
+}
+
+// UpdateForSavePolicy does nothing, see Update.
+func (w *LogWatcher) UpdateForSavePolicy(model model.Model) error {
+	return nil
+}
+
+// UpdateForAddPolicies does nothing, see Update.
+func (w *LogWatcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return nil
+}
+
+// UpdateForRemovePolicies does nothing, see Update.
+func (w *LogWatcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return nil
+}
+
+// UpdateForUpdatePolicy does nothing, see Update.
+func (w *LogWatcher) UpdateForUpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return nil
+}
+
+// UpdateForUpdatePolicies does nothing, see Update.
+func (w *LogWatcher) UpdateForUpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return nil
+}
+
+// Close stops tailing the log.
+func (w *LogWatcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.closed)
+	})
+	<-w.done
+}
@@ -0,0 +1,132 @@
+package gdbadapter
+
+import (
+	"context"
+	"errors"
+	"github.com/casbin/casbin/v2"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	w, err := NewWatcher(ctx, a, WithPollInterval(100*time.Millisecond), WithIgnoreSelf(true))
+	assert.Nil(t, err)
+	defer w.Close()
+
+	peer, err := NewAdapter(ctx, gdb.DefaultGroupName)
+	assert.Nil(t, err)
+	peerWatcher, err := NewWatcher(ctx, peer, WithPollInterval(100*time.Millisecond))
+	assert.Nil(t, err)
+	defer peerWatcher.Close()
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, e.SetWatcher(w))
+
+	// SetWatcher installs its own callback, replace it to observe the notifications.
+	selfUpdates := make(chan string, 10)
+	assert.Nil(t, w.SetUpdateCallback(func(revision string) { selfUpdates <- revision }))
+	peerUpdates := make(chan string, 10)
+	assert.Nil(t, peerWatcher.SetUpdateCallback(func(revision string) { peerUpdates <- revision }))
+
+	_, err = e.AddPolicy("carol", "data3", "read")
+	assert.Nil(t, err)
+
+	select {
+	case <-peerUpdates:
+	case <-time.After(2 * time.Second):
+		t.Error("peer watcher was not notified")
+	}
+	select {
+	case revision := <-selfUpdates:
+		t.Error("watcher was notified of its own revision ", revision)
+	case <-time.After(300 * time.Millisecond):
+	}
+	cleanPolicy(ctx, a)
+}
+
+func TestLogWatcher(t *testing.T) {
+	ctx := context.Background()
+	a := initAdapter(t, ctx, gdb.DefaultGroupName)
+	w, err := NewLogWatcher(ctx, a, WithPollInterval(100*time.Millisecond))
+	assert.Nil(t, err)
+	defer w.Close()
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	assert.Nil(t, e.SetWatcher(w))
+
+	peer, err := NewAdapter(ctx, gdb.DefaultGroupName)
+	assert.Nil(t, err)
+	peerWatcher, err := NewLogWatcher(ctx, peer, WithPollInterval(100*time.Millisecond))
+	assert.Nil(t, err)
+	defer peerWatcher.Close()
+	peerEnforcer, _ := casbin.NewSyncedEnforcer("examples/rbac_model.conf", peer)
+	peerWatcher.SetEnforcer(peerEnforcer)
+
+	_, err = e.AddPolicy("carol", "data3", "read")
+	assert.Nil(t, err)
+	_, err = e.RemovePolicy("bob", "data2", "write")
+	assert.Nil(t, err)
+	_, err = e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"})
+	assert.Nil(t, err)
+	_, err = e.RemoveFilteredPolicy(0, "data2_admin")
+	assert.Nil(t, err)
+	_, err = e.AddGroupingPolicy("bob", "carol")
+	assert.Nil(t, err)
+
+	time.Sleep(500 * time.Millisecond)
+	policy, err := peerEnforcer.GetPolicy()
+	assert.Nil(t, err)
+	assert.True(t, arrayEqualsWithoutOrder(policy, [][]string{{"alice", "data1", "write"}, {"carol", "data3", "read"}}))
+	ok, err := peerEnforcer.Enforce("bob", "data3", "read")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// The peer applies the entries to its model without writing them back, which would log them again.
+	count, err := peer.db.Model(peerWatcher.tableName).Where("created_by", peerWatcher.instanceID).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	// Compaction keeps the last entry.
+	removed, err := w.Compact(ctx, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), removed)
+	cleanPolicy(ctx, a)
+}
+
+func TestLogWatcherTenant(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAdapterWithOptions(ctx, WithTableName("casbin_rule_tenant_log"), WithTenant(contextTenant))
+	assert.Nil(t, err)
+	defer func() {
+		_, _ = a.db.Exec(ctx, a.dialect.dropTableSQL(a.tableName+logTableSuffix))
+		_, _ = a.db.Exec(ctx, a.dialect.dropTableSQL(a.tableName+revisionTableSuffix))
+		_ = a.dropTable()
+	}()
+	ctx1 := context.WithValue(ctx, tenantKey{}, "tenant1")
+	ctx2 := context.WithValue(ctx, tenantKey{}, "tenant2")
+
+	_, err = NewLogWatcher(ctx, a)
+	assert.True(t, errors.Is(err, ErrNoTenant))
+	w, err := NewLogWatcher(ctx1, a, WithPollInterval(100*time.Millisecond))
+	assert.Nil(t, err)
+	defer w.Close()
+
+	peer, err := NewAdapterWithOptions(ctx2, WithTableName("casbin_rule_tenant_log"), WithTenant(contextTenant))
+	assert.Nil(t, err)
+	peerWatcher, err := NewLogWatcher(ctx2, peer, WithPollInterval(100*time.Millisecond))
+	assert.Nil(t, err)
+	defer peerWatcher.Close()
+	peerEnforcer, _ := casbin.NewSyncedEnforcer("examples/rbac_model.conf", peer)
+	peerWatcher.SetEnforcer(peerEnforcer)
+
+	// The peer only applies the changes of its tenant.
+	assert.Nil(t, a.AddPolicyCtx(ctx1, "p", "p", []string{"alice", "data1", "read"}))
+	assert.Nil(t, a.AddPolicyCtx(ctx2, "p", "p", []string{"bob", "data2", "write"}))
+	time.Sleep(500 * time.Millisecond)
+	policy, err := peerEnforcer.GetPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"bob", "data2", "write"}}, policy)
+}